@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/spec"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The address activity index is an optional part of the hash index, with
+// the keys:
+//
+//	'a' + address + first block number of a file -> block numbers
+//	'g' + file name                               -> hash_tree_root of the indexed file
+//	'e' + file name                               -> first block number (8 bytes) + addresses
+//
+// Each archive file contributes one entry per address, holding the
+// increasing numbers of the file's blocks that touched the address, encoded
+// as a uvarint first number followed by uvarint deltas. The 'e' key lists
+// the addresses of these entries, to remove them when the file is indexed
+// again.
+var (
+	addressPrefix     = []byte("a")
+	addressFilePrefix = []byte("g")
+	addressListPrefix = []byte("e")
+)
+
+// BlockAddresses returns the addresses touched by a block: transaction
+// senders and recipients, created contracts, and log emitters. Senders are
+// recovered with sender (see SenderFunc).
+func BlockAddresses(b *spec.Block, sender func(number uint64, tx *types.Transaction) (common.Address, error)) ([]common.Address, error) {
+	seen := make(map[common.Address]bool)
+	for i, enc := range b.Transactions {
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(enc); err != nil {
+			return nil, fmt.Errorf("block %d: invalid transaction %d: %v", b.Header.BlockNumber, i, err)
+		}
+		from, err := sender(b.Header.BlockNumber, &tx)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: transaction %d: %v", b.Header.BlockNumber, i, err)
+		}
+		seen[from] = true
+		if to := tx.To(); to != nil {
+			seen[*to] = true
+		} else {
+			seen[crypto.CreateAddress(from, tx.Nonce())] = true
+		}
+	}
+	for _, r := range b.Receipts {
+		for _, l := range r.Logs {
+			seen[common.BytesToAddress(l.Address)] = true
+		}
+	}
+	addrs := make([]common.Address, 0, len(seen))
+	for a := range seen {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	return addrs, nil
+}
+
+// ActivityIndex maps each address touched by the blocks of an archive to the
+// increasing numbers of the blocks that touched it.
+func ActivityIndex(arc spec.ArchiveBody, sender func(number uint64, tx *types.Transaction) (common.Address, error)) (map[common.Address][]uint64, error) {
+	index := make(map[common.Address][]uint64)
+	for _, b := range arc.Blocks {
+		addrs, err := BlockAddresses(b, sender)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			index[a] = append(index[a], b.Header.BlockNumber)
+		}
+	}
+	return index, nil
+}
+
+func encodeBlockNumbers(numbers []uint64) []byte {
+	b := make([]byte, 0, 2*len(numbers))
+	var buf [binary.MaxVarintLen64]byte
+	prev := uint64(0)
+	for _, n := range numbers {
+		b = append(b, buf[:binary.PutUvarint(buf[:], n-prev)]...)
+		prev = n
+	}
+	return b
+}
+
+func decodeBlockNumbers(b []byte) ([]uint64, error) {
+	var numbers []uint64
+	prev := uint64(0)
+	for len(b) > 0 {
+		d, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid block number list")
+		}
+		prev += d
+		numbers = append(numbers, prev)
+		b = b[n:]
+	}
+	return numbers, nil
+}
+
+// AddressesIndexed reports whether the manifest entry's file was already
+// added to the address index.
+func (ix *HashIndex) AddressesIndexed(e *spec.ManifestEntry) (bool, error) {
+	root, err := ix.db.Get(key(addressFilePrefix, e.Name), nil)
+	if err == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(root, e.Root), nil
+}
+
+// AddFileAddresses adds the archive file of the manifest entry to the
+// address index, recovering transaction senders with sender. If the file was
+// indexed before, its previous entries are replaced.
+func (ix *HashIndex) AddFileAddresses(e *spec.ManifestEntry, sender func(number uint64, tx *types.Transaction) (common.Address, error)) error {
+	name := string(e.Name)
+	file, err := OpenInput(joinName(ix.dir, name))
+	if err != nil {
+		return fmt.Errorf("opening file: %s", err)
+	}
+	_, arc, err := Read(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	index, err := ActivityIndex(arc, sender)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	var first [8]byte
+	binary.BigEndian.PutUint64(first[:], e.HeadBlockNumber)
+	batch := new(leveldb.Batch)
+	if err := ix.removeFileAddresses(batch, e.Name); err != nil {
+		return err
+	}
+	addrs := make([]common.Address, 0, len(index))
+	for a, numbers := range index {
+		batch.Put(key(addressPrefix, append(a.Bytes(), first[:]...)), encodeBlockNumbers(numbers))
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	list := make([]byte, 8, 8+len(addrs)*common.AddressLength)
+	copy(list, first[:])
+	for _, a := range addrs {
+		list = append(list, a[:]...)
+	}
+	batch.Put(key(addressListPrefix, e.Name), list)
+	batch.Put(key(addressFilePrefix, e.Name), e.Root)
+	if err := ix.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("writing index: %s", err)
+	}
+	return nil
+}
+
+// removeFileAddresses adds the deletion of the address entries previously
+// indexed from the file name to the batch.
+func (ix *HashIndex) removeFileAddresses(batch *leveldb.Batch, name []byte) error {
+	list, err := ix.db.Get(key(addressListPrefix, name), nil)
+	if err == errors.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading index: %s", err)
+	}
+	if len(list) < 8 || (len(list)-8)%common.AddressLength != 0 {
+		return fmt.Errorf("reading index: invalid address list of %s", name)
+	}
+	first := list[:8]
+	for addrs := list[8:]; len(addrs) > 0; addrs = addrs[common.AddressLength:] {
+		k := append(key(addressPrefix, addrs[:common.AddressLength]), first...)
+		batch.Delete(k)
+	}
+	batch.Delete(key(addressListPrefix, name))
+	batch.Delete(key(addressFilePrefix, name))
+	return nil
+}
+
+// AddressBlocks returns the increasing numbers of the blocks in the
+// (inclusive) range from-to that touched an address, according to the
+// address index.
+func (ix *HashIndex) AddressBlocks(a common.Address, from, to uint64) ([]uint64, error) {
+	it := ix.db.NewIterator(util.BytesPrefix(key(addressPrefix, a.Bytes())), nil)
+	defer it.Release()
+	var blocks []uint64
+	for it.Next() {
+		numbers, err := decodeBlockNumbers(it.Value())
+		if err != nil {
+			return nil, fmt.Errorf("reading index: address %s: %s", a, err)
+		}
+		for _, n := range numbers {
+			if n >= from && n <= to {
+				blocks = append(blocks, n)
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("reading index: %s", err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// The transactions of test chain blocks are sent by testchain.Sender, and
+// the legacy transaction of block i (the first, if i%4 > 0) is sent to
+// recipient(nonce). The others are sent to testchain.LogAddress, which emits
+// their logs.
+func recipient(nonce byte) common.Address {
+	return common.Address{0xaa, nonce}
+}
+
+func TestBlockAddresses(t *testing.T) {
+	arc := testArchive(t, 8)
+	sender := SenderFunc(testchain.Config)
+	// The addresses are sorted. Block 3 holds the transactions of nonces 3, 4 and 5.
+	want := []common.Address{testchain.LogAddress, testchain.Sender, recipient(3)}
+	if got, err := BlockAddresses(arc.Blocks[3], sender); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("BlockAddresses(block 3) = %x, %v; want %x", got, err, want)
+	}
+	if got, err := BlockAddresses(arc.Blocks[4], sender); err != nil || len(got) != 0 {
+		t.Errorf("BlockAddresses(empty block) = %x, %v", got, err)
+	}
+
+	create, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 7, Gas: 100000, GasPrice: big.NewInt(2e9), Data: []byte{0}}),
+		types.LatestSignerForChainID(testchain.Config.ChainID), testchain.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := create.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := *arc.Blocks[4]
+	b.Transactions = [][]byte{enc}
+	want = []common.Address{testchain.Sender, crypto.CreateAddress(testchain.Sender, 7)}
+	if bytes.Compare(want[1][:], want[0][:]) < 0 {
+		want[0], want[1] = want[1], want[0]
+	}
+	if got, err := BlockAddresses(&b, sender); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("BlockAddresses(contract creation) = %x, %v; want %x", got, err, want)
+	}
+
+	fail := func(uint64, *types.Transaction) (common.Address, error) {
+		return common.Address{}, errors.New("no sender")
+	}
+	if _, err := BlockAddresses(arc.Blocks[3], fail); err == nil {
+		t.Errorf("BlockAddresses with a failing sender succeeded")
+	}
+}
+
+func TestActivityIndex(t *testing.T) {
+	arc := testArchive(t, 8)
+	index, err := ActivityIndex(arc, SenderFunc(testchain.Config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[common.Address][]uint64{
+		testchain.Sender:     {1, 2, 3, 5, 6, 7},
+		testchain.LogAddress: {2, 3, 6, 7},
+		recipient(0):         {1},
+		recipient(1):         {2},
+		recipient(3):         {3},
+		recipient(6):         {5},
+		recipient(7):         {6},
+		recipient(9):         {7},
+	}
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("ActivityIndex = %v, want %v", index, want)
+	}
+}
+
+// writeBlocks writes the blocks to an archive file at path.
+func writeBlocks(t *testing.T, path string, blocks []*spec.Block) *spec.ManifestEntry {
+	t.Helper()
+	archdr := spec.ArchiveHeader{
+		Version:         spec.Version,
+		HeadBlockNumber: blocks[0].Header.BlockNumber,
+		BlockCount:      uint32(len(blocks)),
+	}
+	arc := spec.ArchiveBody{Blocks: blocks}
+	b, err := Encode(arc, archdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManifestEntry(filepath.Base(path), b, archdr, root)
+}
+
+func TestAddressIndex(t *testing.T) {
+	arc := testArchive(t, 20)
+	dir := t.TempDir()
+	ix, err := OpenHashIndex(filepath.Join(t.TempDir(), HashIndexName), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	sender := SenderFunc(testchain.Config)
+	add := func(e *spec.ManifestEntry) {
+		t.Helper()
+		if ok, err := ix.AddressesIndexed(e); ok || err != nil {
+			t.Fatalf("AddressesIndexed(%s) = %v, %v before indexing", e.Name, ok, err)
+		}
+		if err := ix.AddFileAddresses(e, sender); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := ix.AddressesIndexed(e); !ok || err != nil {
+			t.Fatalf("AddressesIndexed(%s) = %v, %v after indexing", e.Name, ok, err)
+		}
+	}
+	check := func(a common.Address, from, to uint64, want []uint64) {
+		t.Helper()
+		if got, err := ix.AddressBlocks(a, from, to); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("AddressBlocks(%x, %d, %d) = %v, %v; want %v", a, from, to, got, err, want)
+		}
+	}
+	add(writeBlocks(t, filepath.Join(dir, "a.ssz"), arc.Blocks[:10]))
+	add(writeBlocks(t, filepath.Join(dir, "b.ssz"), arc.Blocks[10:]))
+	check(testchain.LogAddress, 0, 19, []uint64{2, 3, 6, 7, 10, 11, 14, 15, 18, 19})
+	check(testchain.LogAddress, 5, 10, []uint64{6, 7, 10})
+	check(testchain.Sender, 9, 13, []uint64{9, 10, 11, 13})
+	check(recipient(0), 0, 19, []uint64{1})
+	// Block 10 holds the transactions of nonces 13 and 14.
+	check(recipient(13), 0, 19, []uint64{10})
+	check(recipient(13), 11, 19, nil)
+	check(common.Address{1}, 0, 19, nil)
+
+	// Replace b.ssz with a file starting at a different block: the entries
+	// of the previous file must be gone.
+	e := writeBlocks(t, filepath.Join(dir, "b.ssz"), arc.Blocks[12:])
+	add(e)
+	check(testchain.LogAddress, 0, 19, []uint64{2, 3, 6, 7, 14, 15, 18, 19})
+	check(testchain.Sender, 9, 13, []uint64{9, 13})
+	check(recipient(13), 0, 19, nil)
+	check(recipient(0), 0, 19, []uint64{1})
+}
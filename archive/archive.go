@@ -0,0 +1,245 @@
+// Package archive reads, writes and converts block archive files. An archive
+// file holds an ssz-encoded spec.ArchiveHeader followed by an ssz-encoded
+// spec.ArchiveBody. The package converts rlp block exports to archive files
+// (ConvertRLP) and back (WriteRLP), and describes sets of archive files with
+// manifests.
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// ReadHeader reads the archive header at the start of an archive file.
+func ReadHeader(r io.Reader) (spec.ArchiveHeader, error) {
+	var h spec.ArchiveHeader
+	sz := h.SizeSSZ()
+	buf := make([]byte, sz)
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return spec.ArchiveHeader{}, err
+	}
+	if err := h.UnmarshalSSZ(buf); err != nil {
+		return spec.ArchiveHeader{}, fmt.Errorf("unmarshalling ssz: %s", err)
+	}
+	return h, nil
+}
+
+// ReadBody reads the archive body following the header of an archive file.
+func ReadBody(r io.Reader) (spec.ArchiveBody, error) {
+	var blocks spec.ArchiveBody
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return blocks, fmt.Errorf("reading ssz file: %s", err)
+	}
+	if err = blocks.UnmarshalSSZ(b); err != nil {
+		return blocks, fmt.Errorf("unmarshalling ssz: %s", err)
+	}
+	return blocks, nil
+}
+
+// Read reads a complete archive file and checks that its header and body
+// are consistent.
+func Read(r io.Reader) (spec.ArchiveHeader, spec.ArchiveBody, error) {
+	archdr, err := ReadHeader(r)
+	if err != nil {
+		return archdr, spec.ArchiveBody{}, err
+	}
+	arc, err := ReadBody(r)
+	if err != nil {
+		return archdr, arc, err
+	}
+	if err := Check(arc, archdr); err != nil {
+		return archdr, arc, fmt.Errorf("invalid archive: %s", err)
+	}
+	return archdr, arc, nil
+}
+
+// Check verifies that the archive header describes the blocks in the body.
+func Check(arc spec.ArchiveBody, archdr spec.ArchiveHeader) error {
+	if len(arc.Blocks) == 0 {
+		return fmt.Errorf("archive has no blocks")
+	}
+	if arc.Blocks[0].Header.BlockNumber != archdr.HeadBlockNumber {
+		return fmt.Errorf("header has first block %d, but body has first block %d",
+			archdr.HeadBlockNumber, arc.Blocks[0].Header.BlockNumber)
+	}
+	if len(arc.Blocks) != int(archdr.BlockCount) {
+		return fmt.Errorf("header has block count %d, but body has %d blocks",
+			archdr.BlockCount, len(arc.Blocks))
+	}
+	return nil
+}
+
+// Encode returns the ssz encoding of an archive file, that is the archive
+// header followed by the archive body.
+func Encode(arc spec.ArchiveBody, archdr spec.ArchiveHeader) ([]byte, error) {
+	b, err := archdr.MarshalSSZ()
+	if err != nil {
+		return nil, fmt.Errorf("marshalling SSZ header: %s", err)
+	}
+	if b, err = arc.MarshalSSZTo(b); err != nil {
+		return nil, fmt.Errorf("marshalling SSZ body: %s", err)
+	}
+	return b, nil
+}
+
+// WriteRLP writes the blocks of the given archives to w in the rlp export
+// format, with each block followed by its receipts if receipts is set (the
+// rlprc format). Archives must hold consecutive blocks.
+func WriteRLP(w io.Writer, receipts bool, arcs ...spec.ArchiveBody) error {
+	exp := uint64(0)
+	for i := 0; i < len(arcs); i++ {
+		arc := arcs[i]
+		if exp > 0 && arc.Blocks[0].Header.BlockNumber != exp {
+			return fmt.Errorf("Non-consecutive blocks (%d, expected %d)", arc.Blocks[0].Header.BlockNumber, exp)
+		}
+		exp = arc.Blocks[len(arc.Blocks)-1].Header.BlockNumber + 1
+		if err := writeArcRLP(w, arc, receipts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRLPFile writes archives to the rlp file at path (see WriteRLP and
+// CreateOutput).
+func WriteRLPFile(path string, force bool, receipts bool, arcs ...spec.ArchiveBody) error {
+	o, err := CreateOutput(path, force)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(o)
+	if err := WriteRLP(w, receipts, arcs...); err != nil {
+		o.Abort()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		o.Abort()
+		return err
+	}
+	return o.Commit()
+}
+
+func writeArcRLP(w io.Writer, arc spec.ArchiveBody, receipts bool) error {
+	for i := 0; i < len(arc.Blocks); i++ {
+		var err error
+		if receipts {
+			err = rlp.Encode(w, arc.Blocks[i])
+		} else {
+			err = rlp.Encode(w, (*spec.BlockNoReceipts)(arc.Blocks[i]))
+		}
+		if err != nil {
+			return fmt.Errorf("writing RLP-encoded block: %s", err)
+		}
+	}
+	return nil
+}
+
+// HashWithRootCache computes the root of arc, reusing unchanged block roots
+// from the sidecar cache (<path>.roots) of the archive file at path, and then
+// updates the cache.
+func HashWithRootCache(path string, arc spec.ArchiveBody, workers int) ([32]byte, error) {
+	cachefn := path + ".roots"
+	var cache *spec.BlockRootCache
+	if b, err := ioutil.ReadFile(cachefn); err == nil {
+		cache = &spec.BlockRootCache{}
+		if err := cache.UnmarshalSSZ(b); err != nil {
+			return [32]byte{}, fmt.Errorf("reading root cache %s: %s", cachefn, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return [32]byte{}, err
+	}
+	root, cache, err := arc.HashTreeRootCached(workers, cache)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	b, err := cache.MarshalSSZ()
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("marshalling root cache: %s", err)
+	}
+	if err := WriteFileAtomic(cachefn, b, true); err != nil {
+		return [32]byte{}, fmt.Errorf("writing root cache: %s", err)
+	}
+	return root, nil
+}
+
+// ReadBlock reads block number n from the first of the given archive files
+// that holds it. Only the block is decoded, from its offset in the file, and
+// only the header and offsets of the other files are read. Compressed files
+// and stdin are read up to the end of the block's file.
+func ReadBlock(filenames []string, n uint64) (*spec.Block, error) {
+	for _, fn := range filenames {
+		var b *spec.Block
+		compressed := fn == "-"
+		var err error
+		if !compressed && !IsURL(fn) {
+			compressed, err = IsCompressed(fn)
+		}
+		if err == nil && compressed {
+			b, err = readStreamBlock(fn, n)
+		} else if err == nil {
+			b, err = readFileBlock(fn, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("block %d not found", n)
+}
+
+// readFileBlock reads block n of an uncompressed archive file, or returns nil
+// if the file does not hold it.
+func readFileBlock(fn string, n uint64) (*spec.Block, error) {
+	br, err := OpenBlockReader(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer br.Close()
+	first := br.Header.HeadBlockNumber
+	if n < first || n-first >= uint64(br.Len()) {
+		return nil, nil
+	}
+	b, err := br.Block(int(n - first))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	if b.Header.BlockNumber != n {
+		return nil, fmt.Errorf("%s: invalid archive: block %d has number %d", fn, n-first, b.Header.BlockNumber)
+	}
+	return b, nil
+}
+
+// readStreamBlock reads block n of a compressed archive file, or of stdin, or
+// returns nil if the file does not hold it.
+func readStreamBlock(fn string, n uint64) (*spec.Block, error) {
+	file, err := OpenInput(fn)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %s", err)
+	}
+	defer file.Close()
+	archdr, err := ReadHeader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	if n < archdr.HeadBlockNumber || n >= archdr.HeadBlockNumber+uint64(archdr.BlockCount) {
+		return nil, nil
+	}
+	arc, err := ReadBody(file)
+	if err == nil {
+		err = Check(arc, archdr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	return arc.Blocks[n-archdr.HeadBlockNumber], nil
+}
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func TestReadBlock(t *testing.T) {
+	arc := testArchive(t, 20)
+	dir := t.TempDir()
+	write := func(name string, blocks []*spec.Block, first uint64, compress bool) string {
+		b, err := Encode(spec.ArchiveBody{Blocks: blocks}, spec.ArchiveHeader{
+			Version:         spec.Version,
+			HeadBlockNumber: first,
+			BlockCount:      uint32(len(blocks)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compress {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(b)
+			zw.Close()
+			b = buf.Bytes()
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	first := write("first.ssz", arc.Blocks[:10], 0, false)
+	second := write("second.ssz", arc.Blocks[10:], 10, false)
+	compressed := write("second.ssz.gz", arc.Blocks[10:], 10, true)
+	// A file whose header does not match its blocks.
+	shifted := write("shifted.ssz", arc.Blocks[:10], 5, false)
+
+	for _, files := range [][]string{{first, second}, {first, compressed}} {
+		for _, n := range []uint64{0, 9, 10, 15, 19} {
+			b, err := ReadBlock(files, n)
+			if err != nil {
+				t.Fatalf("ReadBlock(%v, %d): %s", files, n, err)
+			}
+			got, err := b.MarshalSSZ()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := arc.Blocks[n].MarshalSSZ()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("ReadBlock(%v, %d) = block %d, want block %d", files, n, b.Header.BlockNumber, n)
+			}
+		}
+		if _, err := ReadBlock(files, 20); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("ReadBlock(%v, 20) = %v, want a not found error", files, err)
+		}
+	}
+	if _, err := ReadBlock([]string{shifted}, 7); err == nil || !strings.Contains(err.Error(), "has number") {
+		t.Errorf("ReadBlock of a shifted archive = %v, want an invalid archive error", err)
+	}
+	if _, err := ReadBlock([]string{filepath.Join(dir, "missing.ssz"), first}, 0); err == nil {
+		t.Errorf("ReadBlock of a missing file succeeded")
+	}
+}
@@ -0,0 +1,402 @@
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	ssz "github.com/ferranbt/fastssz"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// An archive body is an ssz container with a single variable-size field, the
+// list of blocks. Its encoding is:
+//
+//	offset of the block list (4 bytes, always 4)
+//	offset of each block, relative to the start of the list (4 bytes each)
+//	encoded blocks
+//
+// and each block starts with the offsets of its four (variable-size) fields:
+// Header, Transactions, Uncles and Receipts. BlockReader uses these offsets
+// to read individual blocks, or parts of blocks, without decoding the rest of
+// the archive.
+
+const blockFixedSize = 16
+
+// BlockReader gives random access to the blocks of an archive file.
+type BlockReader struct {
+	r      io.ReaderAt
+	Header spec.ArchiveHeader
+	// list is the file offset of the block list, and starts the file
+	// offsets at which each block starts, followed by the end of the file.
+	// The offsets of a lazy reader are read on demand, and are 0 until
+	// then.
+	list   int64
+	starts []int64
+	lazy   bool
+	mu     sync.Mutex
+}
+
+// NewBlockReader reads the archive header and block offsets of the archive
+// file of the given size held by r.
+func NewBlockReader(r io.ReaderAt, size int64) (*BlockReader, error) {
+	br, table, err := newBlockReader(r, size, false)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(br.Len())
+	for i := int64(0); i < n; i++ {
+		br.starts[i] = br.list + int64(binary.LittleEndian.Uint32(table[4+4*i:]))
+	}
+	for i := int64(0); i < n; i++ {
+		if br.starts[i+1]-br.starts[i] < blockFixedSize {
+			return nil, fmt.Errorf("invalid offset for block %d", i)
+		}
+	}
+	return br, nil
+}
+
+// NewLazyBlockReader is like NewBlockReader, but only reads the archive
+// header upfront. The offsets of each block are read when the block is first
+// accessed, which makes it suitable for remote files (see HTTPReader).
+func NewLazyBlockReader(r io.ReaderAt, size int64) (*BlockReader, error) {
+	br, table, err := newBlockReader(r, size, true)
+	if err != nil {
+		return nil, err
+	}
+	br.starts[0] = br.list + int64(binary.LittleEndian.Uint32(table[4:]))
+	return br, nil
+}
+
+// newBlockReader reads the archive header, and the start of the block
+// offsets table (all of it unless lazy).
+func newBlockReader(r io.ReaderAt, size int64, lazy bool) (*BlockReader, []byte, error) {
+	br := &BlockReader{r: r, lazy: lazy}
+	sz := int64(br.Header.SizeSSZ())
+	hb := make([]byte, sz)
+	if _, err := r.ReadAt(hb, 0); err != nil {
+		return nil, nil, fmt.Errorf("reading header: %s", err)
+	}
+	if err := br.Header.UnmarshalSSZ(hb); err != nil {
+		return nil, nil, fmt.Errorf("unmarshalling ssz: %s", err)
+	}
+	n := int64(br.Header.BlockCount)
+	if n == 0 {
+		return nil, nil, fmt.Errorf("archive has no blocks")
+	}
+	br.list = sz + 4
+	table := make([]byte, 4+4*n)
+	if lazy {
+		table = table[:8]
+	}
+	if _, err := r.ReadAt(table, sz); err != nil {
+		return nil, nil, fmt.Errorf("reading block offsets: %s", err)
+	}
+	if o := binary.LittleEndian.Uint32(table); o != 4 {
+		return nil, nil, fmt.Errorf("invalid block list offset %d", o)
+	}
+	if o := binary.LittleEndian.Uint32(table[4:]); int64(o) != 4*n {
+		return nil, nil, fmt.Errorf("header has block count %d, but body has %d blocks", n, o/4)
+	}
+	br.starts = make([]int64, n+1)
+	br.starts[n] = size
+	return br, table, nil
+}
+
+// OpenBlockReader opens the archive file at path, or at a storage URL (see
+// ParseStorageURL). The file must be uncompressed, as blocks are read at
+// their offset in the file. Files at a URL are read lazily.
+func OpenBlockReader(path string) (*BlockReader, error) {
+	if IsURL(path) {
+		s, name, err := ParseStorageURL(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := s.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		br, err := newStorageBlockReader(r, path)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return br, nil
+	}
+	if c, err := IsCompressed(path); err != nil {
+		return nil, err
+	} else if c {
+		return nil, fmt.Errorf("%s is compressed, random access requires an uncompressed file", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	br, err := NewBlockReader(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return br, nil
+}
+
+// Close closes the underlying reader, if it is an io.Closer.
+func (br *BlockReader) Close() error {
+	if c, ok := br.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Len returns the number of blocks in the archive.
+func (br *BlockReader) Len() int {
+	return len(br.starts) - 1
+}
+
+// Index returns the position in the archive of the block with the given
+// number, and whether the archive holds it.
+func (br *BlockReader) Index(number uint64) (int, bool) {
+	if number < br.Header.HeadBlockNumber || number-br.Header.HeadBlockNumber >= uint64(br.Len()) {
+		return 0, false
+	}
+	return int(number - br.Header.HeadBlockNumber), true
+}
+
+// BlockRange returns the file offset and length of the ssz encoding of block
+// i.
+func (br *BlockReader) BlockRange(i int) (int64, int64, error) {
+	if br.lazy {
+		br.mu.Lock()
+		defer br.mu.Unlock()
+		if err := br.loadOffsets(i); err != nil {
+			return 0, 0, err
+		}
+	}
+	return br.starts[i], br.starts[i+1] - br.starts[i], nil
+}
+
+// loadOffsets reads the offsets of blocks i and i+1 of a lazy reader, if not
+// already read. br.mu must be held.
+func (br *BlockReader) loadOffsets(i int) error {
+	if br.starts[i] != 0 && br.starts[i+1] != 0 {
+		return nil
+	}
+	n := 2
+	if i+1 == br.Len() {
+		n = 1
+	}
+	b, err := br.readAt(br.list+4*int64(i), 4*int64(n))
+	if err != nil {
+		return fmt.Errorf("reading block offsets: %s", err)
+	}
+	for j := 0; j < n; j++ {
+		br.starts[i+j] = br.list + int64(binary.LittleEndian.Uint32(b[4*j:]))
+	}
+	if br.starts[i+1]-br.starts[i] < blockFixedSize {
+		return fmt.Errorf("invalid offset for block %d", i)
+	}
+	return nil
+}
+
+func (br *BlockReader) readAt(off, n int64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := br.r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// BlockBytes returns the ssz encoding of block i.
+func (br *BlockReader) BlockBytes(i int) ([]byte, error) {
+	off, n, err := br.BlockRange(i)
+	if err != nil {
+		return nil, err
+	}
+	b, err := br.readAt(off, n)
+	if err != nil {
+		return nil, fmt.Errorf("reading block %d: %s", i, err)
+	}
+	return b, nil
+}
+
+// Block reads and decodes block i.
+func (br *BlockReader) Block(i int) (*spec.Block, error) {
+	b, err := br.BlockBytes(i)
+	if err != nil {
+		return nil, err
+	}
+	var blk spec.Block
+	if err := blk.UnmarshalSSZ(b); err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d: %s", i, err)
+	}
+	return &blk, nil
+}
+
+// BlockSummary describes a block, as read by Summary.
+type BlockSummary struct {
+	Header       *spec.Header
+	Transactions int
+	Uncles       int
+	Receipts     int
+	// Size is the size of the block's ssz encoding.
+	Size int
+}
+
+// fieldOffsets reads the offsets of the fields of block i, relative to the
+// start of the block, followed by the size of the block.
+func (br *BlockReader) fieldOffsets(i int) (int64, [5]int64, error) {
+	var offs [5]int64
+	start, size, err := br.BlockRange(i)
+	if err != nil {
+		return 0, offs, err
+	}
+	fixed, err := br.readAt(start, blockFixedSize)
+	if err != nil {
+		return 0, offs, fmt.Errorf("reading block %d: %s", i, err)
+	}
+	for j := 0; j < 4; j++ {
+		offs[j] = int64(binary.LittleEndian.Uint32(fixed[4*j:]))
+	}
+	offs[4] = size
+	if offs[0] != blockFixedSize {
+		return 0, offs, fmt.Errorf("block %d: invalid header offset %d", i, offs[0])
+	}
+	for j := 0; j < 4; j++ {
+		if offs[j] > offs[j+1] {
+			return 0, offs, fmt.Errorf("block %d: invalid offsets", i)
+		}
+	}
+	return start, offs, nil
+}
+
+func (br *BlockReader) readHeader(i int, start int64, offs [5]int64) (*spec.Header, error) {
+	hb, err := br.readAt(start+offs[0], offs[1]-offs[0])
+	if err != nil {
+		return nil, fmt.Errorf("reading block %d header: %s", i, err)
+	}
+	var h spec.Header
+	if err := h.UnmarshalSSZ(hb); err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d header: %s", i, err)
+	}
+	return &h, nil
+}
+
+// BlockHeader reads the header of block i, without reading the rest of the
+// block.
+func (br *BlockReader) BlockHeader(i int) (*spec.Header, error) {
+	start, offs, err := br.fieldOffsets(i)
+	if err != nil {
+		return nil, err
+	}
+	return br.readHeader(i, start, offs)
+}
+
+// Summary reads the header of block i and the lengths of its lists, without
+// reading transactions, uncles or receipts.
+func (br *BlockReader) Summary(i int) (*BlockSummary, error) {
+	start, offs, err := br.fieldOffsets(i)
+	if err != nil {
+		return nil, err
+	}
+	h, err := br.readHeader(i, start, offs)
+	if err != nil {
+		return nil, err
+	}
+	s := &BlockSummary{Header: h, Size: int(offs[4])}
+	// Transactions, uncles and receipts are lists of variable-size elements,
+	// so their length is given by the first element offset.
+	for j, n := range []*int{&s.Transactions, &s.Uncles, &s.Receipts} {
+		lo, hi := offs[j+1], offs[j+2]
+		if lo == hi {
+			continue
+		}
+		b, err := br.readAt(start+lo, 4)
+		if err != nil {
+			return nil, fmt.Errorf("reading block %d: %s", i, err)
+		}
+		first := int64(binary.LittleEndian.Uint32(b))
+		if first%4 != 0 || first > hi-lo {
+			return nil, fmt.Errorf("block %d: invalid list offset", i)
+		}
+		*n = int(first / 4)
+	}
+	return s, nil
+}
+
+// fieldBytes returns the ssz encoding of field j (Header, Transactions,
+// Uncles or Receipts) of block i.
+func (br *BlockReader) fieldBytes(i, j int) ([]byte, error) {
+	start, offs, err := br.fieldOffsets(i)
+	if err != nil {
+		return nil, err
+	}
+	b, err := br.readAt(start+offs[j], offs[j+1]-offs[j])
+	if err != nil {
+		return nil, fmt.Errorf("reading block %d: %s", i, err)
+	}
+	return b, nil
+}
+
+// HeaderBytes returns the ssz encoding of the header of block i.
+func (br *BlockReader) HeaderBytes(i int) ([]byte, error) {
+	return br.fieldBytes(i, 0)
+}
+
+// ReceiptsBytes returns the ssz encoding of the receipts of block i, a list
+// of spec.Receipt.
+func (br *BlockReader) ReceiptsBytes(i int) ([]byte, error) {
+	return br.fieldBytes(i, 3)
+}
+
+// Transactions reads the (encoded) transactions of block i, without reading
+// the rest of the block.
+func (br *BlockReader) Transactions(i int) ([][]byte, error) {
+	b, err := br.fieldBytes(i, 1)
+	if err != nil {
+		return nil, err
+	}
+	// The list limit is that of spec.Block.
+	num, err := ssz.DecodeDynamicLength(b, 1048576)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d transactions: %s", i, err)
+	}
+	txs := make([][]byte, num)
+	err = ssz.UnmarshalDynamic(b, num, func(j int, buf []byte) error {
+		txs[j] = buf
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d transactions: %s", i, err)
+	}
+	return txs, nil
+}
+
+// Receipts reads and decodes the receipts of block i, without reading the
+// rest of the block.
+func (br *BlockReader) Receipts(i int) ([]*spec.Receipt, error) {
+	b, err := br.ReceiptsBytes(i)
+	if err != nil {
+		return nil, err
+	}
+	// The list limit is that of spec.Block.
+	num, err := ssz.DecodeDynamicLength(b, 4194452)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d receipts: %s", i, err)
+	}
+	rs := make([]*spec.Receipt, num)
+	err = ssz.UnmarshalDynamic(b, num, func(j int, buf []byte) error {
+		rs[j] = new(spec.Receipt)
+		return rs[j].UnmarshalSSZ(buf)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling block %d receipts: %s", i, err)
+	}
+	return rs, nil
+}
@@ -0,0 +1,517 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// ConvertRLP runs as a pipeline of concurrent stages:
+//
+//	decode:  split the rlp input into raw (undecoded) blocks, grouped into archives
+//	convert: decode raw blocks into spec blocks, using a pool of workers per archive
+//	marshal: hash and ssz-encode archives, several archives at a time
+//	write:   hand archives to the caller, in input order
+//
+// The decode stage takes a token for each archive, which is released once the
+// archive is written, so at most Options.InFlight archives are held in memory
+// whatever the number of workers. Archive boundaries are decided by the
+// (sequential) decode stage and archives are written in order, so the output
+// does not depend on the number of workers, and is the same as the output of
+// the sequential conversion.
+
+// Options configure an rlp to ssz conversion.
+type Options struct {
+	// Receipts is set when each block in the input is followed by its
+	// receipts (the rlprc format).
+	Receipts bool
+	// TargetSize is the approximate amount of rlp input making up one
+	// archive. With 0, all input goes into a single archive.
+	TargetSize int
+	// Workers is the number of workers used to decode blocks and to encode
+	// archives. It defaults to the number of CPUs.
+	Workers int
+	// InFlight is the maximum number of archives held in memory at once,
+	// from the start of their decoding until they are written. It defaults
+	// to DefaultInFlight.
+	InFlight int
+
+	// When resuming a conversion, FirstIndex is the index of the first
+	// archive, StartOffset the input offset at which the reader is
+	// positioned, Buffered the Buffered count of the last archive written,
+	// and NextBlock the block number the input must start with.
+	FirstIndex  int
+	StartOffset int64
+	Buffered    int
+	NextBlock   uint64
+
+	Hooks Hooks
+}
+
+// DefaultInFlight is the default number of archives converted concurrently:
+// one being decoded, one being encoded and one being written.
+const DefaultInFlight = 3
+
+// Hooks are optional callbacks for following the progress of a conversion.
+// They may be called concurrently from multiple goroutines.
+type Hooks struct {
+	// BytesRead is called after each block read from the input.
+	BytesRead func(n int)
+	// BlockConverted is called after each block is decoded.
+	BlockConverted func(number uint64)
+	// ArchiveRead is called once the input for an archive has been read.
+	ArchiveRead func(index, blocks, bytes int, final bool)
+	// ArchiveEncoded is called once an archive has been ssz-encoded.
+	ArchiveEncoded func(index, bytes int)
+}
+
+// Archive is a converted archive file, as handed to the write function of
+// ConvertRLP.
+type Archive struct {
+	// Index is the position of the archive in the output sequence.
+	Index int
+	// End is the input offset at which the archive ends.
+	End int64
+	// Buffered is the number of input bytes after End that had been read
+	// ahead when the archive ended. The size of the next archive is
+	// counted from them on, so a conversion resumed at End needs them to
+	// split the input as an uninterrupted one does.
+	Buffered int
+	Header   spec.ArchiveHeader
+	Root     [32]byte
+	// Bytes holds the ssz encoding of the archive file (see Encode).
+	Bytes []byte
+}
+
+// LastBlock returns the number of the last block in the archive.
+func (a *Archive) LastBlock() uint64 {
+	return a.Header.HeadBlockNumber + uint64(a.Header.BlockCount) - 1
+}
+
+// ConvertRLP reads rlp-encoded blocks from r, converts them to ssz archives,
+// and calls write for each archive, in order. When ctx is cancelled, the
+// conversion stops after the archive currently being written, discarding
+// archives that were read but not yet written, and returns ctx.Err(). An
+// error returned by write stops the conversion and is returned as is.
+func ConvertRLP(ctx context.Context, r io.Reader, opts Options, write func(a *Archive) error) error {
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.InFlight < 1 {
+		opts.InFlight = DefaultInFlight
+	}
+	var ahead []byte
+	if opts.Buffered > 0 {
+		ahead = make([]byte, opts.Buffered)
+		if _, err := io.ReadFull(r, ahead); err != nil {
+			return fmt.Errorf("reading RLP: %s", err)
+		}
+	}
+	p := &pipeline{
+		opts:   opts,
+		reader: newChunkedRLPReader(r, ahead, opts.Receipts, opts.TargetSize),
+		tokens: make(chan struct{}, opts.InFlight),
+		quit:   make(chan struct{}),
+	}
+	p.reader.offset = opts.StartOffset
+	p.reader.readOffset = opts.StartOffset + int64(len(ahead))
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.fail(ctx.Err())
+		case <-p.quit:
+		}
+	}()
+	return p.run(write)
+}
+
+type rawArchive struct {
+	index    int
+	end      int64
+	buffered int
+	blocks   [][]byte
+}
+
+type convertedArchive struct {
+	index    int
+	end      int64
+	buffered int
+	arc      spec.ArchiveBody
+}
+
+type pipeline struct {
+	opts   Options
+	reader *chunkedRLPReader
+	// tokens holds a value for each archive in flight.
+	tokens chan struct{}
+
+	quit    chan struct{}
+	errOnce sync.Once
+	err     error
+}
+
+// fail records the first error and stops all stages.
+func (p *pipeline) fail(err error) {
+	p.errOnce.Do(func() {
+		p.err = err
+		close(p.quit)
+	})
+}
+
+func (p *pipeline) failed() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// run starts the pipeline and calls write for each archive, in order. It
+// returns the first error encountered by any stage.
+func (p *pipeline) run(write func(a *Archive) error) error {
+	defer p.fail(nil)
+	raws := make(chan *rawArchive)
+	convs := make(chan *convertedArchive)
+	marshalled := make(chan *Archive)
+
+	// Archives are marshalled concurrently, sharing the workers for
+	// hashing.
+	marshallers := p.opts.InFlight
+	if marshallers > p.opts.Workers {
+		marshallers = p.opts.Workers
+	}
+	hashers := p.opts.Workers / marshallers
+
+	go p.decode(raws)
+	go p.convert(raws, convs)
+	var wg sync.WaitGroup
+	for i := 0; i < marshallers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.marshal(convs, marshalled, hashers)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(marshalled)
+	}()
+
+	// Marshal workers finish archives out of order; hold them until their
+	// turn comes.
+	pending := make(map[int]*Archive)
+	next := p.opts.FirstIndex
+	exp := p.opts.NextBlock
+	for m := range marshalled {
+		pending[m.Index] = m
+		for {
+			m, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if exp > 0 && m.Header.HeadBlockNumber != exp {
+				err := fmt.Errorf("Non-consecutive blocks (%d, expected %d)", m.Header.HeadBlockNumber, exp)
+				p.fail(err)
+				return err
+			}
+			exp = m.LastBlock() + 1
+			if err := write(m); err != nil {
+				p.fail(err)
+				return err
+			}
+			<-p.tokens
+			if p.failed() {
+				return p.err
+			}
+		}
+	}
+	// Stop the context watcher, which can still record an error, before
+	// reading the error.
+	p.fail(nil)
+	<-p.quit
+	return p.err
+}
+
+func (p *pipeline) decode(out chan<- *rawArchive) {
+	defer close(out)
+	for i := p.opts.FirstIndex; ; i++ {
+		select {
+		case p.tokens <- struct{}{}:
+		case <-p.quit:
+			return
+		}
+		blocks, n, err := p.reader.readOneRaw(p.opts.Hooks.BytesRead)
+		if err != nil && err != io.EOF {
+			p.fail(fmt.Errorf("reading RLP: %s", err))
+			return
+		}
+		if h := p.opts.Hooks.ArchiveRead; h != nil {
+			h(i, len(blocks), n, err == io.EOF)
+		}
+		if len(blocks) > 0 {
+			select {
+			case out <- &rawArchive{index: i, end: p.reader.offset, buffered: p.reader.buffered(), blocks: blocks}:
+			case <-p.quit:
+				return
+			}
+		} else {
+			<-p.tokens
+		}
+		if err == io.EOF {
+			return
+		}
+	}
+}
+
+func (p *pipeline) convert(in <-chan *rawArchive, out chan<- *convertedArchive) {
+	defer close(out)
+	workers := p.opts.Workers
+	for raw := range in {
+		blocks := make([]*spec.Block, len(raw.blocks))
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(blocks); i += workers {
+					b, err := decodeBlock(raw.blocks[i], p.opts.Receipts)
+					if err != nil {
+						p.fail(fmt.Errorf("reading RLP: decoding RLP block %d: %v", i, err))
+						return
+					}
+					blocks[i] = b
+					if h := p.opts.Hooks.BlockConverted; h != nil {
+						h(b.Header.BlockNumber)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		if p.failed() {
+			return
+		}
+		select {
+		case out <- &convertedArchive{index: raw.index, end: raw.end, buffered: raw.buffered, arc: spec.ArchiveBody{Blocks: blocks}}:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *pipeline) marshal(in <-chan *convertedArchive, out chan<- *Archive, hashers int) {
+	for c := range in {
+		archdr := spec.ArchiveHeader{
+			Version:         spec.Version,
+			HeadBlockNumber: c.arc.Blocks[0].Header.BlockNumber,
+			BlockCount:      uint32(len(c.arc.Blocks)),
+		}
+		root, err := c.arc.HashTreeRootParallel(hashers)
+		if err != nil {
+			p.fail(fmt.Errorf("computing hash: %s", err))
+			return
+		}
+		b, err := Encode(c.arc, archdr)
+		if err != nil {
+			p.fail(fmt.Errorf("writing SSZ: %s", err))
+			return
+		}
+		if h := p.opts.Hooks.ArchiveEncoded; h != nil {
+			h(c.index, len(b))
+		}
+		select {
+		case out <- &Archive{Index: c.index, End: c.end, Buffered: c.buffered, Header: archdr, Root: root, Bytes: b}:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// decodeBlock decodes a raw block as returned by readOneRaw.
+func decodeBlock(raw []byte, receipts bool) (*spec.Block, error) {
+	var b spec.Block
+	s := rlp.NewStream(bytes.NewReader(raw), uint64(len(raw)))
+	if receipts {
+		if err := s.Decode(&b); err != nil {
+			return nil, err
+		}
+		return &b, nil
+	}
+	var bn spec.BlockNoReceipts
+	if err := s.Decode(&bn); err != nil {
+		return nil, err
+	}
+	b = (spec.Block)(bn)
+	return &b, nil
+}
+
+// countingReader counts the bytes read from the input, including the bytes
+// the rlp stream reads ahead into its buffer.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// aheadReader returns the bytes read ahead by an interrupted conversion in
+// its first read, so that the rlp stream buffers them as it did, and then
+// reads from r.
+type aheadReader struct {
+	ahead []byte
+	r     io.Reader
+}
+
+func (a *aheadReader) Read(p []byte) (int, error) {
+	if len(a.ahead) > 0 {
+		n := copy(p, a.ahead)
+		a.ahead = a.ahead[n:]
+		return n, nil
+	}
+	return a.r.Read(p)
+}
+
+type chunkedRLPReader struct {
+	// offset is the input offset after the last block read, counting the
+	// bytes of the blocks consumed from the stream rather than the bytes
+	// the stream has buffered, so that it is where a resumed conversion
+	// must start reading. readOffset is the offset up to which the input
+	// has been read.
+	offset     int64
+	readOffset int64
+	cr         *countingReader
+	stream     *rlp.Stream
+	receipts   bool
+	targetSize int
+}
+
+func newChunkedRLPReader(r io.Reader, ahead []byte, receipts bool, targetSize int) *chunkedRLPReader {
+	cr := &countingReader{r: r}
+	return &chunkedRLPReader{
+		cr:         cr,
+		stream:     rlp.NewStream(&aheadReader{ahead: ahead, r: cr}, 0),
+		receipts:   receipts,
+		targetSize: targetSize,
+	}
+}
+
+// buffered returns the number of input bytes after offset that have been
+// read ahead.
+func (c *chunkedRLPReader) buffered() int {
+	return int(c.readOffset + c.cr.n - c.offset)
+}
+
+// readOneRaw reads the raw rlp encoding of the blocks making up one archive,
+// and returns them along with the number of bytes they take in the input.
+// With receipts, each raw block is followed by its raw receipts list. As in
+// the sequential conversion, an archive ends once targetSize bytes have been
+// read from the input since the previous archive ended, including the bytes
+// read ahead by the stream. The input is read as decoding the blocks reads
+// it, so that it is split at the same blocks.
+func (c *chunkedRLPReader) readOneRaw(bytesRead func(n int)) ([][]byte, int, error) {
+	var blocks [][]byte
+	// xxx not checking maxblocks
+	var err error
+	n := 0
+	start := c.cr.n
+	for i := 0; true; i++ {
+		_, _, err = c.stream.Kind()
+		if err != nil {
+			break
+		}
+		if c.targetSize > 0 && c.cr.n-start >= int64(c.targetSize) {
+			break
+		}
+
+		var raw []byte
+		raw, err = readRaw(c.stream, nil)
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("reading RLP block %d: %v", i, err)
+		}
+		if c.receipts {
+			raw, err = readRawReceipts(c.stream, raw)
+			if err != nil && err != io.EOF {
+				return nil, 0, fmt.Errorf("reading RLP receipts %d: %v", i, err)
+			}
+		}
+		c.offset += int64(len(raw))
+		n += len(raw)
+		if bytesRead != nil {
+			bytesRead(len(raw))
+		}
+		blocks = append(blocks, raw)
+	}
+	return blocks, n, err
+}
+
+// readRaw appends the encoding of the next value of the stream to buf. Lists
+// are read an element at a time, as decoding them does.
+func readRaw(s *rlp.Stream, buf []byte) ([]byte, error) {
+	kind, size, err := s.Kind()
+	if err != nil {
+		return buf, err
+	}
+	if kind != rlp.List {
+		raw, err := s.Raw()
+		return append(buf, raw...), err
+	}
+	if _, err := s.List(); err != nil {
+		return buf, err
+	}
+	buf = appendListHeader(buf, size)
+	for {
+		if buf, err = readRaw(s, buf); err == rlp.EOL {
+			break
+		} else if err != nil {
+			return buf, err
+		}
+	}
+	return buf, s.ListEnd()
+}
+
+// readRawReceipts appends the encoding of the next receipts list of the
+// stream to buf. Receipts are read whole, as decoding them does.
+func readRawReceipts(s *rlp.Stream, buf []byte) ([]byte, error) {
+	size, err := s.List()
+	if err != nil {
+		return buf, err
+	}
+	buf = appendListHeader(buf, size)
+	for {
+		raw, err := s.Raw()
+		if err == rlp.EOL {
+			break
+		} else if err != nil {
+			return buf, err
+		}
+		buf = append(buf, raw...)
+	}
+	return buf, s.ListEnd()
+}
+
+func appendListHeader(buf []byte, size uint64) []byte {
+	if size < 56 {
+		return append(buf, 0xC0+byte(size))
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], size)
+	i := 0
+	for b[i] == 0 {
+		i++
+	}
+	buf = append(buf, 0xF7+byte(len(b)-i))
+	return append(buf, b[i:]...)
+}
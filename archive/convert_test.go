@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+func convertAll(t *testing.T, input []byte, opts Options) []*Archive {
+	t.Helper()
+	var arcs []*Archive
+	err := ConvertRLP(context.Background(), bytes.NewReader(input), opts, func(a *Archive) error {
+		arcs = append(arcs, a)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return arcs
+}
+
+func TestConvertParallelMatchesSerial(t *testing.T) {
+	input := testchain.RLPRC(testchain.Generate(500))
+	serial := convertAll(t, input, Options{Receipts: true, TargetSize: 8192, Workers: 1, InFlight: 1})
+	if len(serial) < 5 {
+		t.Fatalf("got %d archives, want several", len(serial))
+	}
+	for _, opts := range []Options{
+		{Receipts: true, TargetSize: 8192, Workers: 8, InFlight: 3},
+		{Receipts: true, TargetSize: 8192, Workers: 3, InFlight: 8},
+	} {
+		parallel := convertAll(t, input, opts)
+		if len(parallel) != len(serial) {
+			t.Fatalf("workers %d: got %d archives, want %d", opts.Workers, len(parallel), len(serial))
+		}
+		for i := range serial {
+			if parallel[i].Index != i || parallel[i].End != serial[i].End || parallel[i].Root != serial[i].Root ||
+				!bytes.Equal(parallel[i].Bytes, serial[i].Bytes) {
+				t.Fatalf("workers %d: archive %d differs from serial conversion", opts.Workers, i)
+			}
+		}
+	}
+
+	next := uint64(0)
+	for _, a := range serial {
+		archdr, arc, err := Read(bytes.NewReader(a.Bytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if archdr != a.Header || archdr.HeadBlockNumber != next {
+			t.Fatalf("archive %d: header %+v, want first block %d", a.Index, archdr, next)
+		}
+		next = a.LastBlock() + 1
+		root, err := arc.HashTreeRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != a.Root {
+			t.Fatalf("archive %d: root %x, want %x", a.Index, a.Root, root)
+		}
+	}
+	if next != 500 {
+		t.Fatalf("archives end at block %d, want 500", next)
+	}
+}
+
+func TestConvertResumeMatchesUninterrupted(t *testing.T) {
+	input := testchain.RLPRC(testchain.Generate(500))
+	opts := Options{Receipts: true, TargetSize: 8192, Workers: 4}
+	all := convertAll(t, input, opts)
+	for _, k := range []int{0, len(all) / 2, len(all) - 2} {
+		resumed := opts
+		resumed.FirstIndex = k + 1
+		resumed.StartOffset = all[k].End
+		resumed.Buffered = all[k].Buffered
+		resumed.NextBlock = all[k].LastBlock() + 1
+		rest := convertAll(t, input[all[k].End:], resumed)
+		if len(rest) != len(all)-k-1 {
+			t.Fatalf("resuming after archive %d: got %d archives, want %d", k, len(rest), len(all)-k-1)
+		}
+		for i, a := range rest {
+			want := all[k+1+i]
+			if a.Index != want.Index || a.End != want.End || !bytes.Equal(a.Bytes, want.Bytes) {
+				t.Fatalf("resuming after archive %d: archive %d differs", k, want.Index)
+			}
+		}
+	}
+}
+
+func TestConvertSplitsAsSequential(t *testing.T) {
+	blocks, receipts := testchain.Generate(500)
+	var plain []byte
+	for _, b := range blocks {
+		enc, err := rlp.EncodeToBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain = append(plain, enc...)
+	}
+	// The number of blocks of each archive, as split by the sequential
+	// conversion, which counted the input read into the rlp stream's buffer.
+	for _, tt := range []struct {
+		input      []byte
+		receipts   bool
+		targetSize int
+		want       []int
+	}{
+		{testchain.RLPRC(blocks, receipts), true, 8192, []int{6, 9, 9, 9, 9, 9, 9, 9, 10, 8, 9, 10, 9, 9, 8, 10, 9, 9, 9, 9, 9, 9, 10,
+			9, 8, 9, 9, 10, 9, 8, 9, 10, 9, 8, 10, 9, 9, 9, 9, 9, 9, 8, 10, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 6}},
+		{testchain.RLPRC(blocks, receipts), true, 30000, []int{33, 36, 37, 36, 36, 37, 36, 36, 36, 36, 36, 36, 36, 33}},
+		{plain, false, 8192, []int{6, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10,
+			10, 10, 10, 10, 10, 10, 10, 10, 10, 9, 10, 10, 10, 10, 10, 10, 10, 10, 10, 9, 11, 9, 11, 9, 10, 6}},
+		{plain, false, 30000, []int{36, 40, 40, 40, 40, 40, 40, 40, 39, 40, 40, 40, 25}},
+	} {
+		arcs := convertAll(t, tt.input, Options{Receipts: tt.receipts, TargetSize: tt.targetSize})
+		var got []int
+		for _, a := range arcs {
+			got = append(got, int(a.Header.BlockCount))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("receipts %v, target size %d: archives of %v blocks, want %v", tt.receipts, tt.targetSize, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// maxDiffBytes is the number of bytes shown for differing byte fields.
+const maxDiffBytes = 64
+
+// Difference is a field that differs between two archives.
+type Difference struct {
+	// Path names the field, e.g. Blocks[512].Receipts[3].Logs[0].Data.
+	Path string
+	// Block is the number of the block holding the field (in the first
+	// archive), if any.
+	Block    uint64
+	HasBlock bool
+	// A and B are the formatted values in each archive. For lists of
+	// different lengths, they are the lengths.
+	A, B string
+}
+
+func (d Difference) String() string {
+	if d.HasBlock {
+		return fmt.Sprintf("%s (block %d):\n  a: %s\n  b: %s", d.Path, d.Block, d.A, d.B)
+	}
+	return fmt.Sprintf("%s:\n  a: %s\n  b: %s", d.Path, d.A, d.B)
+}
+
+// Diff compares two archives block by block and returns their differences,
+// in order, stopping after max differences (0 for all). Blocks are compared
+// by position, and lists of different lengths are compared up to the
+// shorter length, before their lengths are reported as a difference.
+func Diff(a, b spec.ArchiveBody, max int) ([]Difference, error) {
+	d := &differ{max: max}
+	d.list("Blocks", reflect.ValueOf(a.Blocks), reflect.ValueOf(b.Blocks))
+	return d.diffs, d.err
+}
+
+type differ struct {
+	max   int
+	diffs []Difference
+	err   error
+	// block is the block being compared, if any.
+	block *spec.Block
+}
+
+func (d *differ) done() bool {
+	return d.err != nil || (d.max > 0 && len(d.diffs) >= d.max)
+}
+
+func (d *differ) add(path, a, b string) {
+	if d.done() {
+		return
+	}
+	diff := Difference{Path: path, A: a, B: b}
+	if d.block != nil && d.block.Header != nil {
+		diff.Block, diff.HasBlock = d.block.Header.BlockNumber, true
+	}
+	d.diffs = append(d.diffs, diff)
+}
+
+func (d *differ) value(path string, a, b reflect.Value) {
+	if d.done() {
+		return
+	}
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				d.add(path, formatNil(a), formatNil(b))
+			}
+			return
+		}
+		if blk, ok := a.Interface().(*spec.Block); ok {
+			prev := d.block
+			d.block = blk
+			defer func() { d.block = prev }()
+		}
+		d.value(path, a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			d.value(path+"."+a.Type().Field(i).Name, a.Field(i), b.Field(i))
+		}
+	case reflect.Slice:
+		if a.Type().Elem().Kind() == reflect.Uint8 {
+			if !bytes.Equal(a.Bytes(), b.Bytes()) {
+				d.add(path, formatBytes(a.Bytes()), formatBytes(b.Bytes()))
+			}
+			return
+		}
+		d.list(path, a, b)
+	case reflect.Uint64, reflect.Uint32:
+		if a.Uint() != b.Uint() {
+			d.add(path, fmt.Sprint(a.Uint()), fmt.Sprint(b.Uint()))
+		}
+	default:
+		d.err = fmt.Errorf("diff: unsupported kind %s at %s", a.Kind(), path)
+	}
+}
+
+func (d *differ) list(path string, a, b reflect.Value) {
+	for i := 0; i < a.Len() && i < b.Len() && !d.done(); i++ {
+		d.value(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i))
+	}
+	if a.Len() != b.Len() {
+		d.add(path, fmt.Sprintf("length %d", a.Len()), fmt.Sprintf("length %d", b.Len()))
+	}
+}
+
+func formatNil(v reflect.Value) string {
+	if v.IsNil() {
+		return "<nil>"
+	}
+	return "<present>"
+}
+
+func formatBytes(b []byte) string {
+	if len(b) > maxDiffBytes {
+		return fmt.Sprintf("0x%x... (%d bytes)", b[:maxDiffBytes], len(b))
+	}
+	return fmt.Sprintf("0x%x", b)
+}
@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/internal/testchain"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func testArchive(t *testing.T, n int) spec.ArchiveBody {
+	t.Helper()
+	blocks, receipts := testchain.Generate(n)
+	var arc spec.ArchiveBody
+	for i, b := range blocks {
+		sb, err := spec.NewBlock(b, receipts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		arc.Blocks = append(arc.Blocks, sb)
+	}
+	return arc
+}
+
+func TestDiff(t *testing.T) {
+	a, b := testArchive(t, 20), testArchive(t, 21)
+	diffs, err := Diff(a, a, 0)
+	if err != nil || len(diffs) != 0 {
+		t.Fatalf("Diff(a, a) = %v, %v; want no differences", diffs, err)
+	}
+
+	// The first difference is the first differing field, and the length
+	// of the block list comes after the blocks.
+	b.Blocks[7].Receipts[1].Logs[0].Data = []byte{0xff}
+	diffs, err = Diff(a, b, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Path != "Blocks[7].Receipts[1].Logs[0].Data" || diffs[0].Block != 7 {
+		t.Fatalf("first difference is %v, want Blocks[7].Receipts[1].Logs[0].Data", diffs)
+	}
+	diffs, err = Diff(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[1].Path != "Blocks" || diffs[1].A != "length 20" || diffs[1].B != "length 21" {
+		t.Fatalf("differences are %v, want the log data and the block list length", diffs)
+	}
+}
+
+func TestDiffUnsupportedKind(t *testing.T) {
+	type unsupported struct{ S string }
+	d := &differ{}
+	d.value("x", reflect.ValueOf(unsupported{"a"}), reflect.ValueOf(unsupported{"b"}))
+	if d.err == nil {
+		t.Fatal("expected error for unsupported kind")
+	}
+}
@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// fetchReadSize is the size of the ranged reads of downloaded files.
+const fetchReadSize = 4 << 20
+
+// FetchOptions configures Fetch.
+type FetchOptions struct {
+	// FromBlock and ToBlock bound the (inclusive) block range to fetch.
+	FromBlock, ToBlock uint64
+	// Parallel is the number of files downloaded concurrently.
+	Parallel int
+	// FileFetched, if set, is called after each file is downloaded and
+	// verified, with the offset the download resumed from, or with skipped
+	// set if a valid copy of the file was already present.
+	FileFetched func(e *spec.ManifestEntry, resumed int64, skipped bool)
+}
+
+// FilesInRange returns the entries of m describing files that hold blocks in
+// the (inclusive) range from-to.
+func FilesInRange(m *spec.Manifest, from, to uint64) []*spec.ManifestEntry {
+	var entries []*spec.ManifestEntry
+	for _, e := range m.Files {
+		if e.BlockCount == 0 {
+			continue
+		}
+		last := e.HeadBlockNumber + uint64(e.BlockCount) - 1
+		if last >= from && e.HeadBlockNumber <= to {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// joinName returns the name of file name in the directory base of a
+// storage.
+func joinName(base, name string) string {
+	if base == "" {
+		return name
+	}
+	return strings.TrimSuffix(base, "/") + "/" + name
+}
+
+// Fetch downloads the files of the archive directory at base (a storage URL,
+// see ParseStorageURL) holding blocks in the range of opts into the local
+// directory dir, and verifies them against the remote manifest. The
+// downloaded files are added to the manifest of dir, which is returned.
+//
+// Files already present in dir and matching the manifest are not downloaded
+// again, and interrupted downloads (left as <name>.part) are resumed.
+func Fetch(base, dir string, opts FetchOptions) (*spec.Manifest, error) {
+	remote, err := ReadManifest(joinName(base, ManifestJSONName))
+	if err != nil {
+		return nil, fmt.Errorf("reading remote manifest: %s", err)
+	}
+	entries := FilesInRange(remote, opts.FromBlock, opts.ToBlock)
+	if len(entries) == 0 {
+		if opts.ToBlock == math.MaxUint64 {
+			return nil, fmt.Errorf("no archive file holds blocks from %d", opts.FromBlock)
+		}
+		return nil, fmt.Errorf("no archive file holds blocks %d to %d", opts.FromBlock, opts.ToBlock)
+	}
+	s, prefix, err := ParseStorageURL(base)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	var mu sync.Mutex
+	var fetched []*spec.ManifestEntry
+	var errs []string
+	work := make(chan *spec.ManifestEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				resumed, skipped, err := FetchFile(s, joinName(prefix, string(e.Name)), dir, e)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", e.Name, err))
+				} else {
+					fetched = append(fetched, e)
+					if opts.FileFetched != nil {
+						opts.FileFetched(e, resumed, skipped)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, e := range entries {
+		work <- e
+	}
+	close(work)
+	wg.Wait()
+
+	m, err := ReadManifest(filepath.Join(dir, ManifestJSONName))
+	if errors.Is(err, os.ErrNotExist) {
+		m, err = &spec.Manifest{Version: remote.Version}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading local manifest: %s", err)
+	}
+	if len(fetched) > 0 {
+		MergeManifest(m, fetched)
+		if err := WriteManifest(dir, m); err != nil {
+			return nil, fmt.Errorf("writing manifest: %s", err)
+		}
+	}
+	if len(errs) > 0 {
+		return m, fmt.Errorf("fetching %d of %d files failed:\n%s", len(errs), len(entries), strings.Join(errs, "\n"))
+	}
+	return m, nil
+}
+
+// FetchFile downloads the file name of storage s, described by the manifest
+// entry e, into dir. The download goes to <name>.part, resuming from its
+// current size, and the file is only moved into place once its size,
+// sha256 and hash_tree_root are verified. FetchFile returns the offset the
+// download resumed from, or skipped if dir already holds a valid copy of the
+// file.
+func FetchFile(s Storage, name, dir string, e *spec.ManifestEntry) (int64, bool, error) {
+	path := filepath.Join(dir, string(e.Name))
+	if _, err := os.Stat(path); err == nil && CheckFile(dir, e) == nil {
+		return 0, true, nil
+	}
+	r, err := s.Open(name)
+	if err != nil {
+		return 0, false, err
+	}
+	defer r.Close()
+	size := r.Size()
+	if uint64(size) != e.Size {
+		return 0, false, fmt.Errorf("remote size is %d, manifest has %d", size, e.Size)
+	}
+
+	part := path + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	off := st.Size()
+	if off > size {
+		if err := f.Truncate(0); err != nil {
+			return 0, false, err
+		}
+		off = 0
+	}
+	resumed := off
+	buf := make([]byte, fetchReadSize)
+	for off < size {
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := r.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+			return resumed, false, err
+		}
+		if _, err := f.WriteAt(buf[:n], off); err != nil {
+			return resumed, false, err
+		}
+		off += n
+	}
+	if err := f.Sync(); err != nil {
+		return resumed, false, err
+	}
+
+	if err := CheckReader(f, size, e); err != nil {
+		os.Remove(part)
+		if resumed > 0 {
+			// The partial download may be corrupt, start over.
+			f.Close()
+			return FetchFile(s, name, dir, e)
+		}
+		return resumed, false, fmt.Errorf("verifying download: %s", err)
+	}
+	if err := os.Rename(part, path); err != nil {
+		return resumed, false, err
+	}
+	return resumed, false, nil
+}
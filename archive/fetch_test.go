@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// testMirror serves an archive directory holding a test archive file, and
+// returns its URL, the file path and its manifest entry.
+func testMirror(t *testing.T) (string, string, *spec.ManifestEntry) {
+	t.Helper()
+	path, arc := writeTestArchive(t, 30)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archdr := spec.ArchiveHeader{Version: spec.Version, BlockCount: uint32(len(arc.Blocks))}
+	e := NewManifestEntry(path, b, archdr, root)
+	if err := WriteManifest(filepath.Dir(path), &spec.Manifest{Files: []*spec.ManifestEntry{e}}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(path))))
+	t.Cleanup(srv.Close)
+	return srv.URL, path, e
+}
+
+func TestFetch(t *testing.T) {
+	url, path, e := testMirror(t)
+	dir := t.TempDir()
+	m, err := Fetch(url, dir, FetchOptions{ToBlock: math.MaxUint64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 1 {
+		t.Fatalf("fetched manifest has %d files, want 1", len(m.Files))
+	}
+	if err := CheckFile(dir, e); err != nil {
+		t.Errorf("fetched file: %s", err)
+	}
+
+	// A corrupted file, of the right size, is not kept.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir = t.TempDir()
+	if _, err := Fetch(url, dir, FetchOptions{ToBlock: math.MaxUint64}); err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Errorf("Fetch of a corrupted file: %v, want a checksum error", err)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*.ssz*"))
+	if len(names) != 0 {
+		t.Errorf("Fetch of a corrupted file left %v", names)
+	}
+	if err := CheckFile(filepath.Dir(path), e); err == nil {
+		t.Error("CheckFile of a corrupted file succeeded")
+	}
+}
+
+func TestFetchMaliciousManifest(t *testing.T) {
+	url, path, e := testMirror(t)
+	// Names leading out of the fetch directory are rejected, in both
+	// manifest forms.
+	for _, name := range []string{"../" + string(e.Name), "/tmp/evil.ssz", "..", "."} {
+		m := &spec.Manifest{Files: []*spec.ManifestEntry{e}}
+		e.Name = []byte(name)
+		if err := WriteManifest(filepath.Dir(path), m); err != nil {
+			t.Fatal(err)
+		}
+		parent := t.TempDir()
+		dir := filepath.Join(parent, "sub")
+		if _, err := Fetch(url, dir, FetchOptions{ToBlock: math.MaxUint64}); err == nil || !strings.Contains(err.Error(), "invalid file name") {
+			t.Errorf("Fetch with file name %q: %v, want an invalid file name error", name, err)
+		}
+		if names, _ := filepath.Glob(filepath.Join(parent, "*.ssz*")); len(names) != 0 {
+			t.Errorf("Fetch with file name %q wrote %v", name, names)
+		}
+		if _, err := ReadManifest(filepath.Join(filepath.Dir(path), ManifestSSZName)); err == nil {
+			t.Errorf("ReadManifest of an ssz manifest with file name %q succeeded", name)
+		}
+	}
+}
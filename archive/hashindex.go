@@ -0,0 +1,315 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/spec"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// HashIndexName is the default name of the hash index directory, within an
+// archive directory.
+const HashIndexName = "index"
+
+// A hash index is a leveldb database with the following keys:
+//
+//	'h' + block hash       -> block number (8 bytes, big endian)
+//	't' + tx hash          -> block number (8 bytes) + tx index (4 bytes)
+//	'n' + block number     -> file offset (8 bytes) + size (8 bytes) + file name
+//	'd' + block number     -> total difficulty
+//	'f' + file name        -> hash_tree_root of the indexed file
+//
+// Total difficulties are only known if the files are indexed in order,
+// starting from the genesis block. The root of a file being indexed is empty
+// until the file is completely indexed.
+var (
+	blockHashPrefix   = []byte("h")
+	txHashPrefix      = []byte("t")
+	blockNumberPrefix = []byte("n")
+	tdPrefix          = []byte("d")
+	fileRootPrefix    = []byte("f")
+)
+
+// indexBatchSize is the number of entries written to the index at once.
+var indexBatchSize = 100000
+
+// HashIndex maps block and transaction hashes to block numbers, and block
+// numbers to their location in the files of an archive directory.
+type HashIndex struct {
+	db  *leveldb.DB
+	dir string
+	// store holds the archive files, in the directory base.
+	store Storage
+	base  string
+}
+
+// OpenHashIndex opens (or creates) the hash index at path, for the archive
+// files in dir, a local directory or a storage URL (see ParseStorageURL).
+func OpenHashIndex(path, dir string) (*HashIndex, error) {
+	store, base, err := ParseStorageURL(dir)
+	if err != nil {
+		return nil, err
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening index: %s", err)
+	}
+	return &HashIndex{db: db, dir: dir, store: store, base: base}, nil
+}
+
+// Close closes the index database.
+func (ix *HashIndex) Close() error {
+	return ix.db.Close()
+}
+
+func key(prefix []byte, k []byte) []byte {
+	return append(append([]byte{}, prefix...), k...)
+}
+
+func numberKey(prefix []byte, n uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	return key(prefix, b[:])
+}
+
+// Indexed reports whether the manifest entry's file was already indexed.
+func (ix *HashIndex) Indexed(e *spec.ManifestEntry) (bool, error) {
+	root, err := ix.db.Get(key(fileRootPrefix, e.Name), nil)
+	if err == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(root, e.Root), nil
+}
+
+// flush writes the batch to the index once it holds indexBatchSize entries,
+// or if force is set.
+func (ix *HashIndex) flush(batch *leveldb.Batch, force bool) error {
+	if batch.Len() == 0 || (!force && batch.Len() < indexBatchSize) {
+		return nil
+	}
+	if err := ix.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("writing index: %s", err)
+	}
+	batch.Reset()
+	return nil
+}
+
+// AddFile indexes the blocks and transactions of the archive file of the
+// manifest entry. If the file was (even partially) indexed before, the
+// entries of the previously indexed blocks are removed first.
+func (ix *HashIndex) AddFile(e *spec.ManifestEntry) error {
+	name := string(e.Name)
+	if _, err := ix.db.Get(key(fileRootPrefix, e.Name), nil); err == nil {
+		if err := ix.removeFile(name); err != nil {
+			return err
+		}
+	} else if err != errors.ErrNotFound {
+		return fmt.Errorf("reading index: %s", err)
+	}
+	if err := ix.db.Put(key(fileRootPrefix, e.Name), nil, nil); err != nil {
+		return fmt.Errorf("writing index: %s", err)
+	}
+	br, err := OpenBlockReader(joinName(ix.dir, name))
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	var td *big.Int
+	if e.HeadBlockNumber == 0 {
+		td = new(big.Int)
+	} else if prev, ok, err := ix.TotalDifficulty(e.HeadBlockNumber - 1); err != nil {
+		return err
+	} else if ok {
+		td = prev
+	}
+	batch := new(leveldb.Batch)
+	for i := 0; i < br.Len(); i++ {
+		b, err := br.Block(i)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		h, err := b.Header.ToTypes()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		number := make([]byte, 8)
+		binary.BigEndian.PutUint64(number, b.Header.BlockNumber)
+		batch.Put(key(blockHashPrefix, h.Hash().Bytes()), number)
+		if td != nil {
+			td.Add(td, h.Difficulty)
+			batch.Put(numberKey(tdPrefix, b.Header.BlockNumber), td.Bytes())
+		}
+		for j, tx := range b.Transactions {
+			loc := make([]byte, 12)
+			copy(loc, number)
+			binary.BigEndian.PutUint32(loc[8:], uint32(j))
+			batch.Put(key(txHashPrefix, crypto.Keccak256(tx)), loc)
+		}
+		off, size, err := br.BlockRange(i)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		loc := make([]byte, 16, 16+len(name))
+		binary.BigEndian.PutUint64(loc, uint64(off))
+		binary.BigEndian.PutUint64(loc[8:], uint64(size))
+		batch.Put(numberKey(blockNumberPrefix, b.Header.BlockNumber), append(loc, name...))
+		if err := ix.flush(batch, false); err != nil {
+			return err
+		}
+	}
+	batch.Put(key(fileRootPrefix, e.Name), e.Root)
+	return ix.flush(batch, true)
+}
+
+// removeFile deletes the entries of the blocks indexed from the file name.
+// As hashes are not indexed by file, this scans the block and transaction
+// hash entries of the whole index.
+func (ix *HashIndex) removeFile(name string) error {
+	batch := new(leveldb.Batch)
+	lo, hi := uint64(math.MaxUint64), uint64(0)
+	it := ix.db.NewIterator(util.BytesPrefix(blockNumberPrefix), nil)
+	for it.Next() {
+		k, v := it.Key(), it.Value()
+		if len(k) != 9 || len(v) < 16 || string(v[16:]) != name {
+			continue
+		}
+		n := binary.BigEndian.Uint64(k[1:])
+		if n < lo {
+			lo = n
+		}
+		if n > hi {
+			hi = n
+		}
+		batch.Delete(k)
+		batch.Delete(numberKey(tdPrefix, n))
+		if err := ix.flush(batch, false); err != nil {
+			it.Release()
+			return err
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("reading index: %s", err)
+	}
+	if lo <= hi {
+		for _, prefix := range [][]byte{blockHashPrefix, txHashPrefix} {
+			it := ix.db.NewIterator(util.BytesPrefix(prefix), nil)
+			for it.Next() {
+				v := it.Value()
+				if len(v) < 8 {
+					continue
+				}
+				if n := binary.BigEndian.Uint64(v); n < lo || n > hi {
+					continue
+				}
+				batch.Delete(it.Key())
+				if err := ix.flush(batch, false); err != nil {
+					it.Release()
+					return err
+				}
+			}
+			it.Release()
+			if err := it.Error(); err != nil {
+				return fmt.Errorf("reading index: %s", err)
+			}
+		}
+	}
+	batch.Delete(key(fileRootPrefix, []byte(name)))
+	return ix.flush(batch, true)
+}
+
+// BlockNumber returns the number of the block with the given hash.
+func (ix *HashIndex) BlockNumber(hash common.Hash) (uint64, bool, error) {
+	v, err := ix.db.Get(key(blockHashPrefix, hash[:]), nil)
+	if err == errors.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil || len(v) != 8 {
+		return 0, false, fmt.Errorf("reading index: invalid entry for block %s (%v)", hash, err)
+	}
+	return binary.BigEndian.Uint64(v), true, nil
+}
+
+// TxLocation returns the block number and position in the block of the
+// transaction with the given hash.
+func (ix *HashIndex) TxLocation(hash common.Hash) (uint64, int, bool, error) {
+	v, err := ix.db.Get(key(txHashPrefix, hash[:]), nil)
+	if err == errors.ErrNotFound {
+		return 0, 0, false, nil
+	}
+	if err != nil || len(v) != 12 {
+		return 0, 0, false, fmt.Errorf("reading index: invalid entry for transaction %s (%v)", hash, err)
+	}
+	return binary.BigEndian.Uint64(v), int(binary.BigEndian.Uint32(v[8:])), true, nil
+}
+
+// TotalDifficulty returns the total difficulty of the chain up to and
+// including block number n.
+func (ix *HashIndex) TotalDifficulty(n uint64) (*big.Int, bool, error) {
+	v, err := ix.db.Get(numberKey(tdPrefix, n), nil)
+	if err == errors.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reading index: %s", err)
+	}
+	return new(big.Int).SetBytes(v), true, nil
+}
+
+// BlockLocation returns the archive file holding block number n, and the
+// offset and size of the block's ssz encoding in that file.
+func (ix *HashIndex) BlockLocation(n uint64) (string, int64, int64, bool, error) {
+	v, err := ix.db.Get(numberKey(blockNumberPrefix, n), nil)
+	if err == errors.ErrNotFound {
+		return "", 0, 0, false, nil
+	}
+	if err != nil || len(v) < 16 {
+		return "", 0, 0, false, fmt.Errorf("reading index: invalid entry for block %d (%v)", n, err)
+	}
+	off := int64(binary.BigEndian.Uint64(v))
+	size := int64(binary.BigEndian.Uint64(v[8:]))
+	return string(v[16:]), off, size, true, nil
+}
+
+// Block reads block number n from its archive file.
+func (ix *HashIndex) Block(n uint64) (*spec.Block, bool, error) {
+	name, off, size, ok, err := ix.BlockLocation(n)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	f, err := ix.store.Open(joinName(ix.base, name))
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	b := make([]byte, size)
+	if _, err := f.ReadAt(b, off); err != nil && err != io.EOF {
+		return nil, false, fmt.Errorf("reading block %d from %s: %s", n, name, err)
+	}
+	var blk spec.Block
+	if err := blk.UnmarshalSSZ(b); err != nil {
+		return nil, false, fmt.Errorf("unmarshalling block %d from %s: %s", n, name, err)
+	}
+	return &blk, true, nil
+}
+
+// BlockByHash reads the block with the given hash.
+func (ix *HashIndex) BlockByHash(hash common.Hash) (*spec.Block, bool, error) {
+	n, ok, err := ix.BlockNumber(hash)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	return ix.Block(n)
+}
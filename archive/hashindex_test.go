@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func TestHashIndexReindex(t *testing.T) {
+	defer func(n int) { indexBatchSize = n }(indexBatchSize)
+	indexBatchSize = 7
+
+	path, arc := writeTestArchive(t, 40)
+	dir := filepath.Dir(path)
+	ix, err := OpenHashIndex(filepath.Join(t.TempDir(), HashIndexName), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	e := &spec.ManifestEntry{Name: []byte(filepath.Base(path)), BlockCount: 40, Root: []byte{1}}
+	if err := ix.AddFile(e); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ix.Indexed(e); !ok || err != nil {
+		t.Fatalf("Indexed = %v, %v; want true", ok, err)
+	}
+	old := arc.Blocks[30]
+	h, err := old.Header.ToTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, err := ix.BlockByHash(h.Hash()); !ok || err != nil || b.Header.BlockNumber != 30 {
+		t.Fatalf("BlockByHash(block 30) = %v, %v", ok, err)
+	}
+	if len(old.Transactions) == 0 {
+		t.Fatal("block 30 has no transactions")
+	}
+	txHash := crypto.Keccak256Hash(old.Transactions[0])
+	if n, _, ok, err := ix.TxLocation(txHash); !ok || err != nil || n != 30 {
+		t.Fatalf("TxLocation(block 30 tx) = %d, %v, %v", n, ok, err)
+	}
+
+	// Replace the file with a shorter one: the entries of the blocks it
+	// no longer holds must be gone.
+	b, err := Encode(spec.ArchiveBody{Blocks: arc.Blocks[:20]}, spec.ArchiveHeader{Version: spec.Version, BlockCount: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e = &spec.ManifestEntry{Name: e.Name, BlockCount: 20, Root: []byte{2}}
+	if ok, err := ix.Indexed(e); ok || err != nil {
+		t.Fatalf("Indexed(changed file) = %v, %v; want false", ok, err)
+	}
+	if err := ix.AddFile(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := ix.BlockNumber(h.Hash()); ok || err != nil {
+		t.Errorf("BlockNumber(removed block) = %v, %v; want not found", ok, err)
+	}
+	if _, _, ok, err := ix.TxLocation(txHash); ok || err != nil {
+		t.Errorf("TxLocation(removed tx) = %v, %v; want not found", ok, err)
+	}
+	if _, _, _, ok, err := ix.BlockLocation(30); ok || err != nil {
+		t.Errorf("BlockLocation(30) = %v, %v; want not found", ok, err)
+	}
+	if _, ok, err := ix.TotalDifficulty(30); ok || err != nil {
+		t.Errorf("TotalDifficulty(30) = %v, %v; want not found", ok, err)
+	}
+	if b, ok, err := ix.Block(19); !ok || err != nil || b.Header.BlockNumber != 19 {
+		t.Errorf("Block(19) = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,177 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Input is an opened input file. Reads return decompressed data.
+type Input struct {
+	io.Reader
+	// Compressed is set for gzip or zstd compressed inputs.
+	Compressed bool
+	closers    []io.Closer
+}
+
+func (in *Input) Close() error {
+	var err error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if cerr := in.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// OpenInput opens the named file, or stdin for "-", or a storage URL (see
+// ParseStorageURL). Gzip and zstd compressed data is detected by its magic
+// bytes and transparently decompressed.
+func OpenInput(fn string) (*Input, error) {
+	in := &Input{}
+	var f io.Reader
+	if fn == "-" {
+		f = os.Stdin
+	} else if IsURL(fn) {
+		s, name, err := ParseStorageURL(fn)
+		if err != nil {
+			return nil, err
+		}
+		r, err := s.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		in.closers = append(in.closers, r)
+		// Read remote files in large ranges.
+		f = bufio.NewReaderSize(io.NewSectionReader(r, 0, r.Size()), remoteReadSize)
+	} else {
+		fh, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		in.closers = append(in.closers, fh)
+		f = fh
+	}
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		in.Close()
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			in.Close()
+			return nil, err
+		}
+		in.closers = append(in.closers, zr)
+		in.Reader = zr
+		in.Compressed = true
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			in.Close()
+			return nil, err
+		}
+		in.closers = append(in.closers, zr.IOReadCloser())
+		in.Reader = zr
+		in.Compressed = true
+	default:
+		in.Reader = br
+	}
+	return in, nil
+}
+
+// MultiReader returns the concatenation of the given inputs (see OpenInput),
+// starting at offset. The offset refers to the decompressed data; plain files
+// are skipped or seeked over, and other inputs are read and discarded up to
+// the offset.
+func MultiReader(filenames []string, offset int64) (io.Reader, error) {
+	var readers []io.Reader
+	for i := 0; i < len(filenames); i++ {
+		fn := filenames[i]
+		if offset > 0 && fn != "-" && !IsURL(fn) {
+			fi, err := os.Stat(fn)
+			if err != nil {
+				return nil, err
+			}
+			compressed, err := IsCompressed(fn)
+			if err != nil {
+				return nil, err
+			}
+			if !compressed {
+				if offset >= fi.Size() {
+					offset -= fi.Size()
+					continue
+				}
+				fh, err := os.Open(fn)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				offset = 0
+				readers = append(readers, fh)
+				continue
+			}
+		}
+		in, err := OpenInput(fn)
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			n, err := io.CopyN(ioutil.Discard, in, offset)
+			offset -= n
+			if err == io.EOF {
+				in.Close()
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		readers = append(readers, in)
+	}
+	return io.MultiReader(readers...), nil
+}
+
+// IsCompressed reports whether the named file holds gzip or zstd data.
+func IsCompressed(fn string) (bool, error) {
+	in, err := OpenInput(fn)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	return in.Compressed, nil
+}
+
+// InputSize returns the total size of the given files, or 0 if it is not
+// known in advance because an input is stdin, remote or compressed.
+func InputSize(filenames []string) (int64, error) {
+	var total int64
+	for _, fn := range filenames {
+		if fn == "-" || IsURL(fn) {
+			return 0, nil
+		}
+		if compressed, err := IsCompressed(fn); err != nil || compressed {
+			return 0, err
+		}
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return 0, err
+		}
+		total += fi.Size()
+	}
+	return total, nil
+}
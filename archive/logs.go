@@ -0,0 +1,265 @@
+package archive
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// LogFilter selects logs with the semantics of the eth_getLogs filter.
+type LogFilter struct {
+	// FromBlock and ToBlock bound the (inclusive) block range. Use
+	// NewLogFilter, or set ToBlock, as a zero ToBlock only matches block 0.
+	FromBlock, ToBlock uint64
+	// Addresses matches logs emitted by any of the addresses. An empty
+	// list matches all logs.
+	Addresses []common.Address
+	// Topics matches topics by position: a log matches if, for each
+	// position, its topic is one of the listed topics. An empty list at a
+	// position matches any topic, but the log must have a topic there.
+	Topics [][]common.Hash
+}
+
+// NewLogFilter returns a filter matching all logs.
+func NewLogFilter() LogFilter {
+	return LogFilter{ToBlock: math.MaxUint64}
+}
+
+// Match reports whether a log matches the address and topic criteria.
+func (f *LogFilter) Match(l *spec.Log) bool {
+	if len(f.Addresses) > 0 {
+		addr := common.BytesToAddress(l.Address)
+		found := false
+		for _, a := range f.Addresses {
+			if a == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, sub := range f.Topics {
+		if len(sub) == 0 {
+			continue
+		}
+		topic := common.BytesToHash(l.Topics[i])
+		found := false
+		for _, t := range sub {
+			if t == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchBloom reports whether a block with the given logs bloom may hold
+// logs matching the address and topic criteria. A false result means that no
+// log of the block matches.
+func (f *LogFilter) MatchBloom(bloom []byte) bool {
+	b := types.BytesToBloom(bloom)
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, a := range f.Addresses {
+			if types.BloomLookup(b, a) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, sub := range f.Topics {
+		found := len(sub) == 0
+		for _, t := range sub {
+			if types.BloomLookup(b, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *LogFilter) hasCriteria() bool {
+	if len(f.Addresses) > 0 {
+		return true
+	}
+	for _, sub := range f.Topics {
+		if len(sub) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// FilteredLog is a log returned by FilterLogs, along with its position in
+// the chain.
+type FilteredLog struct {
+	*spec.Log
+	BlockNumber uint64
+	BlockHash   common.Hash
+	TxHash      common.Hash
+	TxIndex     uint
+	// Index is the position of the log in the block.
+	Index uint
+}
+
+// ToTypes converts the log to a go-ethereum log, with its derived fields.
+func (l *FilteredLog) ToTypes() *types.Log {
+	tl := l.Log.ToTypes()
+	tl.BlockNumber = l.BlockNumber
+	tl.BlockHash = l.BlockHash
+	tl.TxHash = l.TxHash
+	tl.TxIndex = l.TxIndex
+	tl.Index = l.Index
+	return tl
+}
+
+// FilterLogs calls fn, in order, for each log of the given archive files
+// matching the filter. Files holding no block in the filter range are
+// skipped after reading their header, and blocks whose logs bloom does not
+// match the filter are skipped after reading their header. Only the
+// receipts of the other blocks are decoded, along with their transactions
+// if a log matches. An error returned by fn stops the search and is
+// returned.
+func FilterLogs(filenames []string, f LogFilter, fn func(l *FilteredLog) error) error {
+	for _, name := range filenames {
+		if err := filterFileLogs(name, &f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindLogs returns the logs of the given archive files matching the filter.
+func FindLogs(filenames []string, f LogFilter) ([]*FilteredLog, error) {
+	var logs []*FilteredLog
+	err := FilterLogs(filenames, f, func(l *FilteredLog) error {
+		logs = append(logs, l)
+		return nil
+	})
+	return logs, err
+}
+
+func filterFileLogs(name string, f *LogFilter, fn func(l *FilteredLog) error) error {
+	br, err := OpenBlockReader(name)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	// Errors returned by fn are returned as is, others name the file.
+	var fnErr error
+	err = FilterReaderLogs(br, *f, func(l *FilteredLog) error {
+		fnErr = fn(l)
+		return fnErr
+	})
+	if err != nil && err != fnErr {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return err
+}
+
+// FilterReaderLogs is like FilterLogs, for the archive file read by br.
+func FilterReaderLogs(br *BlockReader, f LogFilter, fn func(l *FilteredLog) error) error {
+	first := br.Header.HeadBlockNumber
+	last := first + uint64(br.Len()) - 1
+	if last < f.FromBlock || first > f.ToBlock {
+		return nil
+	}
+	lo, hi := 0, br.Len()-1
+	if f.FromBlock > first {
+		lo = int(f.FromBlock - first)
+	}
+	if f.ToBlock < last {
+		hi = int(f.ToBlock - first)
+	}
+	bloom := f.hasCriteria()
+	for i := lo; i <= hi; i++ {
+		var h *spec.Header
+		var err error
+		if bloom {
+			if h, err = br.BlockHeader(i); err != nil {
+				return err
+			}
+			if !f.MatchBloom(h.LogsBloom) {
+				continue
+			}
+		}
+		rs, err := br.Receipts(i)
+		if err != nil {
+			return err
+		}
+		if err := filterBlockLogs(br, i, h, rs, &f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterBlockLogs calls fn for each log of the receipts rs of block i
+// matching the filter. The block header (if nil) and transactions are only
+// read once a log matches.
+func filterBlockLogs(br *BlockReader, i int, h *spec.Header, rs []*spec.Receipt, f *LogFilter, fn func(l *FilteredLog) error) error {
+	var blockHash common.Hash
+	var txs [][]byte
+	index := uint(0)
+	for j, r := range rs {
+		for _, l := range r.Logs {
+			logIndex := index
+			index++
+			if !f.Match(l) {
+				continue
+			}
+			if txs == nil {
+				var err error
+				if h == nil {
+					if h, err = br.BlockHeader(i); err != nil {
+						return err
+					}
+				}
+				th, err := h.ToTypes()
+				if err != nil {
+					return err
+				}
+				blockHash = th.Hash()
+				if txs, err = br.Transactions(i); err != nil {
+					return err
+				}
+			}
+			if j >= len(txs) {
+				return fmt.Errorf("block %d has %d transactions but %d receipts", h.BlockNumber, len(txs), len(rs))
+			}
+			err := fn(&FilteredLog{
+				Log:         l,
+				BlockNumber: h.BlockNumber,
+				BlockHash:   blockHash,
+				// The hash of a transaction is the hash of its encoding.
+				TxHash:  crypto.Keccak256Hash(txs[j]),
+				TxIndex: uint(j),
+				Index:   logIndex,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// writeTestArchive writes an archive file of n test blocks, and returns its
+// path and body.
+func writeTestArchive(t *testing.T, n int) (string, spec.ArchiveBody) {
+	t.Helper()
+	arc := testArchive(t, n)
+	b, err := Encode(arc, spec.ArchiveHeader{
+		Version:         spec.Version,
+		HeadBlockNumber: arc.Blocks[0].Header.BlockNumber,
+		BlockCount:      uint32(len(arc.Blocks)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.ssz")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, arc
+}
+
+func TestFilterLogs(t *testing.T) {
+	path, arc := writeTestArchive(t, 40)
+	for _, f := range []LogFilter{
+		NewLogFilter(),
+		{FromBlock: 7, ToBlock: 23},
+		{ToBlock: 100, Topics: [][]common.Hash{{testchain.Topic}}},
+		{FromBlock: 10, ToBlock: 100, Addresses: []common.Address{testchain.LogAddress}},
+	} {
+		// The logs found by decoding whole blocks.
+		var want []*FilteredLog
+		for _, b := range arc.Blocks {
+			n := b.Header.BlockNumber
+			if n < f.FromBlock || n > f.ToBlock {
+				continue
+			}
+			h, err := b.Header.ToTypes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			index := uint(0)
+			for i, r := range b.Receipts {
+				for _, l := range r.Logs {
+					if f.Match(l) {
+						want = append(want, &FilteredLog{Log: l, BlockNumber: n, BlockHash: h.Hash(),
+							TxHash: crypto.Keccak256Hash(b.Transactions[i]), TxIndex: uint(i), Index: index})
+					}
+					index++
+				}
+			}
+		}
+		if len(want) == 0 {
+			t.Fatalf("filter %+v: no test logs", f)
+		}
+		got, err := FindLogs([]string{path}, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("filter %+v: got %d logs, want %d", f, len(got), len(want))
+		}
+		for i := range got {
+			g, w := got[i].ToTypes(), want[i].ToTypes()
+			if g.BlockHash != w.BlockHash || g.TxHash != w.TxHash || g.TxIndex != w.TxIndex || g.Index != w.Index || g.Topics[0] != w.Topics[0] {
+				t.Errorf("filter %+v: log %d is %+v, want %+v", f, i, g, w)
+			}
+		}
+	}
+
+	f := LogFilter{ToBlock: 100, Addresses: []common.Address{{1}}}
+	if logs, err := FindLogs([]string{path}, f); err != nil || len(logs) != 0 {
+		t.Errorf("filter %+v: got %d logs, %v; want none", f, len(logs), err)
+	}
+}
@@ -0,0 +1,285 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// Names of the manifest files written into an archive directory.
+const (
+	ManifestJSONName = "manifest.json"
+	ManifestSSZName  = "manifest.ssz"
+)
+
+// manifestFile is the JSON form of a spec.ManifestEntry.
+type manifestFile struct {
+	Name            string `json:"name"`
+	HeadBlockNumber uint64 `json:"head_block_number"`
+	BlockCount      uint32 `json:"block_count"`
+	HashTreeRoot    string `json:"hash_tree_root"`
+	Size            uint64 `json:"size"`
+	Sha256          string `json:"sha256"`
+}
+
+type manifestJSON struct {
+	Version uint64         `json:"version"`
+	Files   []manifestFile `json:"files"`
+}
+
+func manifestToJSON(m *spec.Manifest) manifestJSON {
+	mj := manifestJSON{Version: m.Version, Files: []manifestFile{}}
+	for _, e := range m.Files {
+		mj.Files = append(mj.Files, manifestFile{
+			Name:            string(e.Name),
+			HeadBlockNumber: e.HeadBlockNumber,
+			BlockCount:      e.BlockCount,
+			HashTreeRoot:    hex.EncodeToString(e.Root),
+			Size:            e.Size,
+			Sha256:          hex.EncodeToString(e.Sha256),
+		})
+	}
+	return mj
+}
+
+// checkFileName verifies that an archive file name of a manifest names a
+// file of the archive directory, and not a path leading out of it.
+func checkFileName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return nil
+}
+
+func manifestFromJSON(mj manifestJSON) (*spec.Manifest, error) {
+	if len(mj.Files) > spec.MaxFiles {
+		return nil, fmt.Errorf("manifest has %d files, the limit is %d", len(mj.Files), spec.MaxFiles)
+	}
+	m := &spec.Manifest{Version: mj.Version}
+	for _, f := range mj.Files {
+		if err := checkFileName(f.Name); err != nil {
+			return nil, err
+		}
+		root, err := hex.DecodeString(f.HashTreeRoot)
+		if err != nil || len(root) != 32 {
+			return nil, fmt.Errorf("invalid hash_tree_root for %s", f.Name)
+		}
+		sum, err := hex.DecodeString(f.Sha256)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid sha256 for %s", f.Name)
+		}
+		m.Files = append(m.Files, &spec.ManifestEntry{
+			Name:            []byte(f.Name),
+			HeadBlockNumber: f.HeadBlockNumber,
+			BlockCount:      f.BlockCount,
+			Root:            root,
+			Size:            f.Size,
+			Sha256:          sum,
+		})
+	}
+	return m, nil
+}
+
+// NewManifestEntry describes an archive file whose encoded contents are b.
+func NewManifestEntry(name string, b []byte, archdr spec.ArchiveHeader, root [32]byte) *spec.ManifestEntry {
+	sum := sha256.Sum256(b)
+	return &spec.ManifestEntry{
+		Name:            []byte(filepath.Base(name)),
+		HeadBlockNumber: archdr.HeadBlockNumber,
+		BlockCount:      archdr.BlockCount,
+		Root:            root[:],
+		Size:            uint64(len(b)),
+		Sha256:          sum[:],
+	}
+}
+
+// MarshalManifestJSON returns the JSON form of a manifest.
+func MarshalManifestJSON(m *spec.Manifest) ([]byte, error) {
+	j, err := json.MarshalIndent(manifestToJSON(m), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshalling JSON manifest: %s", err)
+	}
+	return append(j, '\n'), nil
+}
+
+// UnmarshalManifestJSON parses the JSON form of a manifest.
+func UnmarshalManifestJSON(b []byte) (*spec.Manifest, error) {
+	var mj manifestJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return nil, fmt.Errorf("unmarshalling JSON manifest: %s", err)
+	}
+	return manifestFromJSON(mj)
+}
+
+// WriteManifest writes the JSON and SSZ forms of the manifest into dir.
+func WriteManifest(dir string, m *spec.Manifest) error {
+	return WriteManifestTo(LocalStorage{}, dir, m)
+}
+
+// WriteManifestTo writes the JSON and SSZ forms of the manifest into dir,
+// within storage s.
+func WriteManifestTo(s Storage, dir string, m *spec.Manifest) error {
+	j, err := MarshalManifestJSON(m)
+	if err != nil {
+		return err
+	}
+	if err := WriteObject(s, filepath.Join(dir, ManifestJSONName), j, true); err != nil {
+		return err
+	}
+	b, err := m.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("marshalling SSZ manifest: %s", err)
+	}
+	return WriteObject(s, filepath.Join(dir, ManifestSSZName), b, true)
+}
+
+// ReadManifestFrom reads the JSON manifest of dir, within storage s.
+func ReadManifestFrom(s Storage, dir string) (*spec.Manifest, error) {
+	b, err := ReadObject(s, filepath.Join(dir, ManifestJSONName))
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalManifestJSON(b)
+}
+
+// MergeManifest adds the entries to m, replacing entries with the same name,
+// and keeps the files of m ordered by block number.
+func MergeManifest(m *spec.Manifest, entries []*spec.ManifestEntry) {
+	for _, e := range entries {
+		replaced := false
+		for i, f := range m.Files {
+			if string(f.Name) == string(e.Name) {
+				m.Files[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			m.Files = append(m.Files, e)
+		}
+	}
+	sort.SliceStable(m.Files, func(i, j int) bool {
+		return m.Files[i].HeadBlockNumber < m.Files[j].HeadBlockNumber
+	})
+}
+
+// ReadManifest reads a manifest in either JSON or SSZ form, based on the
+// file extension. path can be a storage URL (see ParseStorageURL).
+func ReadManifest(path string) (*spec.Manifest, error) {
+	var b []byte
+	var err error
+	if IsURL(path) {
+		var s Storage
+		var name string
+		if s, name, err = ParseStorageURL(path); err == nil {
+			b, err = ReadObject(s, name)
+		}
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".ssz") {
+		var m spec.Manifest
+		if err := m.UnmarshalSSZ(b); err != nil {
+			return nil, fmt.Errorf("unmarshalling ssz manifest: %s", err)
+		}
+		for _, e := range m.Files {
+			if err := checkFileName(string(e.Name)); err != nil {
+				return nil, err
+			}
+		}
+		return &m, nil
+	}
+	return UnmarshalManifestJSON(b)
+}
+
+// CheckFile verifies that the file described by e is present in dir
+// and matches the recorded size, checksum, block range and root.
+func CheckFile(dir string, e *spec.ManifestEntry) error {
+	f, err := os.Open(filepath.Join(dir, string(e.Name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return CheckReader(f, st.Size(), e)
+}
+
+// CheckReader verifies that the archive file of the given size read by r
+// matches the size, checksum, block range and root recorded by the manifest
+// entry e. The file is read sequentially for its checksum, and then a block
+// at a time for its root, so that it is not held in memory.
+func CheckReader(r io.ReaderAt, size int64, e *spec.ManifestEntry) error {
+	if uint64(size) != e.Size {
+		return fmt.Errorf("size is %d, manifest has %d", size, e.Size)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return err
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, e.Sha256) {
+		return fmt.Errorf("sha256 is %x, manifest has %x", sum, e.Sha256)
+	}
+	br, err := NewBlockReader(r, size)
+	if err != nil {
+		return err
+	}
+	if br.Header.HeadBlockNumber != e.HeadBlockNumber || br.Header.BlockCount != e.BlockCount {
+		return fmt.Errorf("header has blocks %d+%d, manifest has %d+%d",
+			br.Header.HeadBlockNumber, br.Header.BlockCount, e.HeadBlockNumber, e.BlockCount)
+	}
+	roots := make([][32]byte, br.Len())
+	workers := runtime.NumCPU()
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			for i := w; i < len(roots); i += workers {
+				b, err := br.Block(i)
+				if err == nil && i == 0 && b.Header.BlockNumber != e.HeadBlockNumber {
+					err = fmt.Errorf("invalid archive: header has first block %d, but body has first block %d",
+						e.HeadBlockNumber, b.Header.BlockNumber)
+				}
+				if err == nil {
+					roots[i], err = b.HashTreeRoot()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+	for w := 0; w < workers; w++ {
+		if werr := <-errs; werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	root, err := spec.ArchiveBodyRoot(roots)
+	if err != nil {
+		return fmt.Errorf("computing hash: %s", err)
+	}
+	if !bytes.Equal(root[:], e.Root) {
+		return fmt.Errorf("hash_tree_root is %x, manifest has %x", root, e.Root)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func TestManifestReadWrite(t *testing.T) {
+	path, arc := writeTestArchive(t, 10)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archdr := spec.ArchiveHeader{Version: spec.Version, BlockCount: uint32(len(arc.Blocks))}
+	m := &spec.Manifest{Version: spec.Version, Files: []*spec.ManifestEntry{
+		NewManifestEntry(path, b, archdr, root),
+		NewManifestEntry("other.ssz", b[:100], spec.ArchiveHeader{HeadBlockNumber: 10, BlockCount: 5}, [32]byte{1}),
+	}}
+	dir := t.TempDir()
+	if err := WriteManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{ManifestJSONName, ManifestSSZName} {
+		got, err := ReadManifest(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("%s: read %+v, want %+v", name, got, m)
+		}
+	}
+	if got, err := ReadManifestFrom(LocalStorage{}, dir); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("ReadManifestFrom = %+v, %v; want %+v", got, err, m)
+	}
+	if _, err := ReadManifestFrom(LocalStorage{}, t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("ReadManifestFrom of a directory without manifest: %v, want a not exist error", err)
+	}
+
+	for _, j := range []string{
+		`{"version":0,"files":[{"name":"a.ssz","hash_tree_root":"00","sha256":""}]}`,
+		`{"version":0,"files":[{"name":"sub/a.ssz"}]}`,
+		`{"version":0,"files":[`,
+	} {
+		if m, err := UnmarshalManifestJSON([]byte(j)); err == nil {
+			t.Errorf("UnmarshalManifestJSON(%s) = %+v, want an error", j, m)
+		}
+	}
+}
+
+func TestMergeManifest(t *testing.T) {
+	entry := func(name string, first uint64) *spec.ManifestEntry {
+		return &spec.ManifestEntry{Name: []byte(name), HeadBlockNumber: first}
+	}
+	names := func(m *spec.Manifest) string {
+		var s []string
+		for _, e := range m.Files {
+			s = append(s, string(e.Name))
+		}
+		return strings.Join(s, ",")
+	}
+	for _, tt := range []struct {
+		files, entries []*spec.ManifestEntry
+		want           string
+	}{
+		{nil, []*spec.ManifestEntry{entry("b", 10), entry("a", 0)}, "a,b"},
+		{[]*spec.ManifestEntry{entry("a", 0), entry("c", 20)}, []*spec.ManifestEntry{entry("b", 10)}, "a,b,c"},
+		// Entries replace the entry of the same name, and files with the
+		// same first block keep their order.
+		{[]*spec.ManifestEntry{entry("a", 0), entry("b", 10)}, []*spec.ManifestEntry{entry("a", 30)}, "b,a"},
+		{[]*spec.ManifestEntry{entry("a", 0), entry("b", 0)}, []*spec.ManifestEntry{entry("c", 0), entry("b", 0)}, "a,b,c"},
+	} {
+		m := &spec.Manifest{Files: tt.files}
+		MergeManifest(m, tt.entries)
+		if got := names(m); got != tt.want {
+			t.Errorf("MergeManifest(%s) = %s, want %s", names(&spec.Manifest{Files: tt.files}), got, tt.want)
+		}
+	}
+}
+
+func TestCheckReader(t *testing.T) {
+	arc := testArchive(t, 20)
+	encode := func(archdr spec.ArchiveHeader) []byte {
+		b, err := Encode(arc, archdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	root, err := arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archdr := spec.ArchiveHeader{Version: spec.Version, BlockCount: 20}
+	b := encode(archdr)
+	e := NewManifestEntry("test.ssz", b, archdr, root)
+	if err := CheckReader(bytes.NewReader(b), int64(len(b)), e); err != nil {
+		t.Fatalf("CheckReader of a valid file: %s", err)
+	}
+
+	corrupted := append([]byte{}, b...)
+	corrupted[len(b)-1] ^= 1
+	// A file whose header does not match its blocks, with a matching
+	// checksum.
+	shifted := encode(spec.ArchiveHeader{Version: spec.Version, HeadBlockNumber: 5, BlockCount: 20})
+	shiftedSum := sha256.Sum256(shifted)
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		edit func(e *spec.ManifestEntry)
+		want string
+	}{
+		{"truncated", b[:len(b)-1], nil, "size"},
+		{"corrupted", corrupted, nil, "sha256"},
+		{"wrong count", b, func(e *spec.ManifestEntry) { e.BlockCount = 19 }, "header has blocks"},
+		{"wrong root", b, func(e *spec.ManifestEntry) { e.Root = make([]byte, 32) }, "hash_tree_root"},
+		{"wrong first block", shifted, func(e *spec.ManifestEntry) {
+			e.HeadBlockNumber = 5
+			e.Sha256 = shiftedSum[:]
+		}, "body has first block"},
+	} {
+		e := *e
+		if tt.edit != nil {
+			tt.edit(&e)
+		}
+		err := CheckReader(bytes.NewReader(tt.b), int64(len(tt.b)), &e)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: CheckReader = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
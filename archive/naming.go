@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+var placeholderRe = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+// numberFormatRe matches the formats of numeric placeholders: an optional
+// zero-padded width, and decimal or hex.
+var numberFormatRe = regexp.MustCompile(`^(0?[1-9][0-9]?)?[dx]$`)
+
+// Namer builds output file names for ssz archives. With a template, names
+// are rendered from the archive contents: {network}, {index}, {first} and
+// {last} (block numbers) and {root} (hex hash_tree_root). Numeric
+// placeholders take an optional format of a width, zero-padded if it starts
+// with 0, and d or x, such as {first:08d}, and {root:8} keeps the first 8 hex
+// characters. Without a template, names are derived from the base name and
+// the file index (name-0.ssz, name-1.ssz, ...).
+type Namer struct {
+	// Dir is the directory output files are placed in.
+	Dir string
+	// Base is the output file name used without a template.
+	Base     string
+	Template string
+	// Network is the value of the {network} placeholder.
+	Network string
+	// Numbered appends the file index to Base.
+	Numbered bool
+}
+
+// Validate checks the template for unknown placeholders or bad formats. The
+// template of a numbered output must name each file differently, with one of
+// {index}, {first}, {last} or {root}.
+func (n Namer) Validate() error {
+	if n.Template == "" {
+		return nil
+	}
+	if _, err := n.render(0, spec.ArchiveHeader{}, [32]byte{}); err != nil {
+		return err
+	}
+	if n.Numbered {
+		for _, m := range placeholderRe.FindAllStringSubmatch(n.Template, -1) {
+			switch m[1] {
+			case "index", "first", "last", "root":
+				return nil
+			}
+		}
+		return fmt.Errorf("name template of split output needs one of {index}, {first}, {last} or {root}")
+	}
+	return nil
+}
+
+// Name returns the path of the i-th output file, holding the archive with the
+// given header and root.
+func (n Namer) Name(i int, archdr spec.ArchiveHeader, root [32]byte) (string, error) {
+	var name string
+	switch {
+	case n.Template != "":
+		var err error
+		if name, err = n.render(i, archdr, root); err != nil {
+			return "", err
+		}
+	case n.Numbered:
+		name = numberedFileName(n.Base, i)
+	default:
+		name = n.Base
+	}
+	if n.Dir != "" {
+		name = filepath.Join(n.Dir, name)
+	}
+	return name, nil
+}
+
+func (n Namer) render(i int, archdr spec.ArchiveHeader, root [32]byte) (string, error) {
+	var err error
+	last := archdr.HeadBlockNumber
+	if archdr.BlockCount > 0 {
+		last += uint64(archdr.BlockCount) - 1
+	}
+	name := placeholderRe.ReplaceAllStringFunc(n.Template, func(p string) string {
+		m := placeholderRe.FindStringSubmatch(p)
+		key, format := m[1], m[2]
+		switch key {
+		case "network":
+			return n.Network
+		case "index":
+			return formatNumber(uint64(i), format, &err)
+		case "first":
+			return formatNumber(archdr.HeadBlockNumber, format, &err)
+		case "last":
+			return formatNumber(last, format, &err)
+		case "root":
+			h := hex.EncodeToString(root[:])
+			if format == "" {
+				return h
+			}
+			l, perr := strconv.Atoi(format)
+			if perr != nil || l <= 0 || l > len(h) {
+				err = fmt.Errorf("invalid root length %q in name template", format)
+				return ""
+			}
+			return h[:l]
+		default:
+			err = fmt.Errorf("unknown placeholder {%s} in name template", key)
+			return ""
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("name template must not contain path separators (use -dir)")
+	}
+	return name, nil
+}
+
+func formatNumber(v uint64, format string, err *error) string {
+	if format == "" {
+		return strconv.FormatUint(v, 10)
+	}
+	if !numberFormatRe.MatchString(format) {
+		*err = fmt.Errorf("invalid number format %q in name template", format)
+		return ""
+	}
+	return fmt.Sprintf("%"+format, v)
+}
+
+func numberedFileName(basename string, n int) string {
+	suffix := filepath.Ext(basename)
+	name := strings.TrimSuffix(basename, suffix)
+	name = name + fmt.Sprintf("-%d", n) + suffix
+	return name
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func TestNamer(t *testing.T) {
+	archdr := spec.ArchiveHeader{HeadBlockNumber: 1000, BlockCount: 500}
+	root := [32]byte{0xab, 0xcd, 0xef}
+	for _, tt := range []struct {
+		namer Namer
+		want  string
+	}{
+		{Namer{Base: "out.ssz"}, "out.ssz"},
+		{Namer{Base: "out.ssz", Numbered: true}, "out-3.ssz"},
+		{Namer{Dir: "dir", Base: "out.ssz", Numbered: true}, filepath.Join("dir", "out-3.ssz")},
+		{Namer{Template: "{network}-{index}.ssz", Network: "mainnet"}, "mainnet-3.ssz"},
+		{Namer{Template: "{first:08d}-{last:08d}.ssz", Numbered: true}, "00001000-00001499.ssz"},
+		{Namer{Template: "{first:x}-{last:06x}.ssz"}, "3e8-0005db.ssz"},
+		{Namer{Template: "{root}.ssz"}, "abcdef0000000000000000000000000000000000000000000000000000000000.ssz"},
+		{Namer{Template: "{root:8}.ssz", Dir: "dir"}, filepath.Join("dir", "abcdef00.ssz")},
+	} {
+		if err := tt.namer.Validate(); err != nil {
+			t.Errorf("%+v: Validate() = %s", tt.namer, err)
+			continue
+		}
+		name, err := tt.namer.Name(3, archdr, root)
+		if err != nil || name != tt.want {
+			t.Errorf("%+v: Name() = %q, %v; want %q", tt.namer, name, err, tt.want)
+		}
+	}
+}
+
+func TestNamerValidate(t *testing.T) {
+	for _, n := range []Namer{
+		{Template: "{height}.ssz"},
+		{Template: "{first:s%d}.ssz"},
+		{Template: "{first:%d}.ssz"},
+		{Template: "{first:8s}.ssz"},
+		{Template: "{first:08.2d}.ssz"},
+		{Template: "{last:-8d}.ssz"},
+		{Template: "{index:0d}.ssz"},
+		{Template: "{root:0}.ssz"},
+		{Template: "{root:65}.ssz"},
+		{Template: "{root:x}.ssz"},
+		{Template: "sub/{index}.ssz"},
+		// Split output needs a placeholder that differs between files.
+		{Template: "{network}.ssz", Numbered: true},
+		{Template: "archive.ssz", Numbered: true},
+	} {
+		if err := n.Validate(); err == nil {
+			t.Errorf("%+v: Validate() succeeded", n)
+		}
+	}
+	for _, n := range []Namer{
+		{Template: "{network}.ssz"},
+		{Template: "{network}-{index}.ssz", Numbered: true},
+		{Template: "{root:8}.ssz", Numbered: true},
+		{Template: "{last:010d}.ssz", Numbered: true},
+	} {
+		if err := n.Validate(); err != nil {
+			t.Errorf("%+v: Validate() = %s", n, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// AnyNetwork is the network name for archives whose chain configuration is
+// unknown. Transaction senders are then recovered by spec.Sender from the
+// chain id of each transaction, without applying fork rules.
+const AnyNetwork = "any"
+
+type network struct {
+	config    *params.ChainConfig
+	genesis   common.Hash
+	bootnodes []string
+}
+
+var networks = map[string]network{
+	"mainnet": {params.MainnetChainConfig, params.MainnetGenesisHash, params.MainnetBootnodes},
+	"ropsten": {params.RopstenChainConfig, params.RopstenGenesisHash, params.RopstenBootnodes},
+	"sepolia": {params.SepoliaChainConfig, params.SepoliaGenesisHash, params.SepoliaBootnodes},
+	"rinkeby": {params.RinkebyChainConfig, params.RinkebyGenesisHash, params.RinkebyBootnodes},
+	"goerli":  {params.GoerliChainConfig, params.GoerliGenesisHash, params.GoerliBootnodes},
+}
+
+// ChainConfig returns the chain configuration of a known network, or nil for
+// AnyNetwork.
+func ChainConfig(network string) (*params.ChainConfig, error) {
+	if network == AnyNetwork {
+		return nil, nil
+	}
+	n, ok := networks[network]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q (known: mainnet, ropsten, sepolia, rinkeby, goerli, %s)", network, AnyNetwork)
+	}
+	return n.config, nil
+}
+
+// GenesisHash returns the genesis block hash of a known network, and false
+// for AnyNetwork or an unknown network.
+func GenesisHash(network string) (common.Hash, bool) {
+	n, ok := networks[network]
+	return n.genesis, ok
+}
+
+// Bootnodes returns the devp2p bootstrap nodes (enode URLs) of a known
+// network, or nil.
+func Bootnodes(network string) []string {
+	return networks[network].bootnodes
+}
+
+// SenderFunc returns a function recovering transaction senders for blocks
+// of the network with the given chain configuration (see spec.Sender).
+func SenderFunc(cfg *params.ChainConfig) func(number uint64, tx *types.Transaction) (common.Address, error) {
+	return func(number uint64, tx *types.Transaction) (common.Address, error) {
+		return spec.Sender(cfg, number, tx)
+	}
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OutputFile is an output file that only appears under its final name once
+// completely written. Data is written to a temporary file in the same
+// directory (<path>.<random>.tmp), which Commit fsyncs and moves into place,
+// so a crash or failed write never leaves a truncated file under the final
+// name, and concurrent writers of the same path do not share a temporary
+// file.
+type OutputFile struct {
+	*os.File
+	path  string
+	force bool
+}
+
+// CreateOutput creates an output file. Unless force is set, it fails if a
+// file already exists at path, or if one is created there before Commit.
+func CreateOutput(path string, force bool) (*OutputFile, error) {
+	if !force {
+		// Fail early, rather than after writing the file. Commit does not
+		// overwrite a file created meanwhile.
+		if _, err := os.Stat(path); err == nil {
+			return nil, existsError(path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not open output file %s: %s", path, err)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &OutputFile{File: f, path: path, force: force}, nil
+}
+
+func existsError(path string) error {
+	return fmt.Errorf("output file %s already exists (use -force to overwrite)", path)
+}
+
+// Commit flushes the file to disk and moves it to its final name. Unless the
+// file was created with force, the file is linked to its final name, which
+// fails if a file exists there.
+func (o *OutputFile) Commit() error {
+	if err := o.Sync(); err != nil {
+		o.Abort()
+		return err
+	}
+	if err := o.Close(); err != nil {
+		os.Remove(o.Name())
+		return err
+	}
+	if o.force {
+		if err := os.Rename(o.Name(), o.path); err != nil {
+			os.Remove(o.Name())
+			return err
+		}
+	} else {
+		err := os.Link(o.Name(), o.path)
+		os.Remove(o.Name())
+		if os.IsExist(err) {
+			return existsError(o.path)
+		} else if err != nil {
+			return err
+		}
+	}
+	// Make the rename itself durable.
+	if d, err := os.Open(filepath.Dir(o.path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Abort discards the file.
+func (o *OutputFile) Abort() {
+	o.Close()
+	os.Remove(o.Name())
+}
+
+// WriteFileAtomic writes b to path through an OutputFile.
+func WriteFileAtomic(path string, b []byte, force bool) error {
+	o, err := CreateOutput(path, force)
+	if err != nil {
+		return err
+	}
+	if _, err := o.Write(b); err != nil {
+		o.Abort()
+		return err
+	}
+	return o.Commit()
+}
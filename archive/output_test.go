@@ -0,0 +1,53 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputFileNoClobber(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.ssz")
+	a, err := CreateOutput(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := CreateOutput(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name() == b.Name() {
+		t.Fatalf("concurrent writers share temporary file %s", a.Name())
+	}
+	a.WriteString("a")
+	b.WriteString("b")
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Commit(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("second commit without force: got %v, want already exists error", err)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "b" {
+		t.Fatalf("output holds %q, want %q", got, "b")
+	}
+	if _, err := CreateOutput(path, false); err == nil {
+		t.Fatal("creating an existing output without force succeeded")
+	}
+
+	if err := WriteFileAtomic(path, []byte("c"), true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "c" {
+		t.Fatalf("output holds %q, want %q", got, "c")
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0644 {
+		t.Fatalf("output mode %v (%v), want 0644", fi.Mode(), err)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d files, want only the output", len(entries))
+	}
+}
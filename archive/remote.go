@@ -0,0 +1,294 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default cache parameters of an HTTPReader.
+const (
+	DefaultChunkSize  = 64 << 10
+	DefaultCacheSize  = 64
+	maxRemoteReadSize = 256 << 20
+	// remoteReadSize is the size of sequential reads of remote inputs.
+	remoteReadSize = 4 << 20
+)
+
+// HTTPReader is an io.ReaderAt over a remote file, which it reads with HTTP
+// Range requests. Reads are rounded to chunks, and the most recently used
+// chunks are cached, so that the small reads of a lazy BlockReader (see
+// NewLazyBlockReader) don't each cost a request. Concurrent reads are
+// fetched in parallel. Range requests are conditional on the file's ETag,
+// when the server sends one, so that reads fail if the file is replaced.
+type HTTPReader struct {
+	url    string
+	client *http.Client
+	// sign, if set, is applied to each request (see S3Storage).
+	sign func(req *http.Request, payload []byte)
+	size int64
+	// etag is the file's strong ETag when opened, or empty.
+	etag string
+	// ctx is canceled by Close, aborting a request in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ChunkSize and CacheSize are the size of a chunk, and the number of
+	// chunks cached. They can be changed before the first read.
+	ChunkSize int64
+	CacheSize int
+
+	// mu guards the cache and counters, but is not held during requests.
+	mu     sync.Mutex
+	chunks map[int64][]byte
+	// lru holds the cached chunk indices, least recently used first.
+	lru []int64
+	// Requests and Bytes count the range requests made and bytes received.
+	Requests int
+	Bytes    int64
+}
+
+// OpenHTTP returns a reader for the file at url, with the default client and
+// cache parameters. The server must support Range requests.
+func OpenHTTP(url string) (*HTTPReader, error) {
+	return OpenHTTPClient(http.DefaultClient, url)
+}
+
+// OpenHTTPClient is like OpenHTTP, but makes requests with the given client.
+func OpenHTTPClient(client *http.Client, url string) (*HTTPReader, error) {
+	return openHTTP(client, url, nil)
+}
+
+// openHTTP probes the file at url with a request for its first byte, which
+// tells both its size and whether the server supports Range requests.
+func openHTTP(client *http.Client, url string, sign func(req *http.Request, payload []byte)) (*HTTPReader, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	if sign != nil {
+		sign(req, nil)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		cr := resp.Header.Get("Content-Range")
+		i := strings.LastIndexByte(cr, '/')
+		if i < 0 {
+			return nil, fmt.Errorf("%s: invalid Content-Range %q", url, cr)
+		}
+		if size, err = strconv.ParseInt(cr[i+1:], 10, 64); err != nil || size < 0 {
+			return nil, fmt.Errorf("%s: unknown size (Content-Range %q)", url, cr)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Only the first byte of an empty file is out of range.
+	case http.StatusOK:
+		// Servers may ignore the range of an empty file.
+		if resp.ContentLength != 0 {
+			return nil, fmt.Errorf("%s: server does not support range requests", url)
+		}
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", url, os.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	// Weak ETags cannot make a range request conditional.
+	etag := resp.Header.Get("ETag")
+	if strings.HasPrefix(etag, "W/") {
+		etag = ""
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPReader{
+		url:       url,
+		client:    client,
+		sign:      sign,
+		size:      size,
+		etag:      etag,
+		ctx:       ctx,
+		cancel:    cancel,
+		ChunkSize: DefaultChunkSize,
+		CacheSize: DefaultCacheSize,
+		chunks:    make(map[int64][]byte),
+	}, nil
+}
+
+// Size returns the size of the remote file.
+func (r *HTTPReader) Size() int64 {
+	return r.size
+}
+
+// Close aborts a read in progress and drops the cached chunks. Later reads
+// fail.
+func (r *HTTPReader) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks = make(map[int64][]byte)
+	r.lru = nil
+	return nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *HTTPReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if r.ctx.Err() != nil {
+		return 0, os.ErrClosed
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if end-off > maxRemoteReadSize {
+		return 0, fmt.Errorf("read of %d bytes exceeds maximum of %d", end-off, maxRemoteReadSize)
+	}
+	r.mu.Lock()
+	chunkSize := r.ChunkSize
+	first, last := off/chunkSize, (end-1)/chunkSize
+	// put copies the part of chunk c that was read into p.
+	put := func(c int64, chunk []byte) {
+		lo, dst := int64(0), c*chunkSize-off
+		if c == first {
+			lo, dst = off-c*chunkSize, 0
+		}
+		copy(p[dst:end-off], chunk[lo:])
+	}
+	// Cached chunks are copied first, as caching the fetched chunks may
+	// evict them.
+	var missing []int64
+	for c := first; c <= last; c++ {
+		if chunk, ok := r.chunks[c]; ok {
+			put(c, chunk)
+			r.touch(c)
+		} else {
+			missing = append(missing, c)
+		}
+	}
+	r.mu.Unlock()
+	for i := 0; i < len(missing); {
+		// Consecutive missing chunks are fetched at once.
+		j := i
+		for j+1 < len(missing) && missing[j+1] == missing[j]+1 {
+			j++
+		}
+		b, err := r.fetch(missing[i]*chunkSize, (missing[j]+1)*chunkSize)
+		if err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		r.Requests++
+		r.Bytes += int64(len(b))
+		for c := missing[i]; c <= missing[j]; c++ {
+			lo := (c - missing[i]) * chunkSize
+			hi := lo + chunkSize
+			if hi > int64(len(b)) {
+				hi = int64(len(b))
+			}
+			// Chunks are copied, so as not to hold on to b.
+			chunk := append([]byte(nil), b[lo:hi]...)
+			put(c, chunk)
+			r.chunks[c] = chunk
+			r.touch(c)
+		}
+		r.mu.Unlock()
+		i = j + 1
+	}
+	if n := int(end - off); n < len(p) {
+		return n, io.EOF
+	}
+	return len(p), nil
+}
+
+// fetch reads the bytes from start to end (exclusive, and capped to the
+// file size) with a single request.
+func (r *HTTPReader) fetch(start, end int64) ([]byte, error) {
+	if end > r.size {
+		end = r.size
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if r.etag != "" {
+		// The server sends the whole file instead if it changed.
+		req.Header.Set("If-Range", r.etag)
+	}
+	if r.sign != nil {
+		r.sign(req, nil)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && r.etag != "" {
+		return nil, fmt.Errorf("%s: file changed since it was opened", r.url)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%s: range request returned %s", r.url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", r.url, err)
+	}
+	if int64(len(b)) != end-start {
+		return nil, fmt.Errorf("%s: range request returned %d bytes, expected %d", r.url, len(b), end-start)
+	}
+	return b, nil
+}
+
+// touch marks chunk c as the most recently used, evicting the least
+// recently used chunks beyond CacheSize.
+func (r *HTTPReader) touch(c int64) {
+	for i, k := range r.lru {
+		if k == c {
+			r.lru = append(r.lru[:i], r.lru[i+1:]...)
+			break
+		}
+	}
+	r.lru = append(r.lru, c)
+	for len(r.lru) > r.CacheSize {
+		delete(r.chunks, r.lru[0])
+		r.lru = r.lru[1:]
+	}
+}
+
+// NewRemoteBlockReader returns a lazy BlockReader (see NewLazyBlockReader)
+// over the remote archive file read by r, which must be uncompressed.
+func NewRemoteBlockReader(r *HTTPReader) (*BlockReader, error) {
+	return newStorageBlockReader(r, r.url)
+}
+
+// newStorageBlockReader returns a lazy BlockReader over the archive file
+// name, read by r, which must be uncompressed.
+func newStorageBlockReader(r StorageReader, name string) (*BlockReader, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(magic, gzipMagic) || bytes.HasPrefix(magic, zstdMagic) {
+		return nil, fmt.Errorf("%s is compressed, random access requires an uncompressed file", name)
+	}
+	br, err := NewLazyBlockReader(r, r.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return br, nil
+}
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves data at /file with Range support, and without it at
+// /norange.
+func rangeServer(t *testing.T, data []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+		case "/empty":
+			http.ServeContent(w, r, "empty", time.Time{}, bytes.NewReader(nil))
+		case "/norange":
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPReader(t *testing.T) {
+	data := make([]byte, 100<<10+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	srv := rangeServer(t, data)
+
+	r, err := OpenHTTP(srv.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("Size() = %d, want %d", r.Size(), len(data))
+	}
+	r.ChunkSize, r.CacheSize = 1024, 4
+	read := func(off, n int64) {
+		t.Helper()
+		p := make([]byte, n)
+		got, err := r.ReadAt(p, off)
+		want := int64(len(data)) - off
+		if want > n {
+			want = n
+		}
+		if int64(got) != want || (err != nil && !(err == io.EOF && want < n)) {
+			t.Fatalf("ReadAt(%d bytes at %d) = %d, %v; want %d", n, off, got, err, want)
+		}
+		if !bytes.Equal(p[:got], data[off:off+want]) {
+			t.Fatalf("ReadAt(%d bytes at %d) returned wrong data", n, off)
+		}
+	}
+
+	// A read larger than the cache: chunks 1 to 10, of which 7 to 10 stay
+	// cached.
+	read(1500, 9*1024+100)
+	if r.Requests != 1 {
+		t.Errorf("%d requests, want 1", r.Requests)
+	}
+	// Chunks 5 to 12: only the uncached chunks around the cached ones are
+	// fetched, in two requests.
+	reqs, bytes0 := r.Requests, r.Bytes
+	read(5*1024, 8*1024)
+	if r.Requests-reqs != 2 || r.Bytes-bytes0 != 4*1024 {
+		t.Errorf("%d requests of %d bytes, want 2 of %d", r.Requests-reqs, r.Bytes-bytes0, 4*1024)
+	}
+	// Cached chunks are not fetched again.
+	reqs = r.Requests
+	read(11*1024+10, 1024)
+	if r.Requests != reqs {
+		t.Errorf("%d requests for cached chunks", r.Requests-reqs)
+	}
+	// Reads at the end of the file.
+	read(int64(len(data))-10, 100)
+	read(int64(len(data))-3000, 3000)
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Error("ReadAt after Close succeeded")
+	}
+
+	if r, err := OpenHTTP(srv.URL + "/empty"); err != nil || r.Size() != 0 {
+		t.Errorf("OpenHTTP(empty file) = %v; want size 0", err)
+	}
+	if _, err := OpenHTTP(srv.URL + "/norange"); err == nil {
+		t.Error("OpenHTTP succeeded without range support")
+	}
+	if _, err := OpenHTTP(srv.URL + "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenHTTP(missing file) = %v, want ErrNotExist", err)
+	}
+}
+
+func TestHTTPReaderConcurrent(t *testing.T) {
+	data := make([]byte, 16<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	// Requests beyond the first chunk signal started, and wait until release
+	// is closed.
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" && r.Header.Get("Range") != "bytes=0-1023" {
+			started <- struct{}{}
+			<-release
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+	r, err := OpenHTTP(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.ChunkSize = 1024
+	p := make([]byte, 100)
+	if _, err := r.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := make(chan error)
+	go func() {
+		_, err := r.ReadAt(make([]byte, 100), 8<<10)
+		blocked <- err
+	}()
+	<-started
+	// Reads of cached chunks don't wait for the request in progress.
+	done := make(chan error)
+	go func() {
+		_, err := r.ReadAt(p, 10)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil || !bytes.Equal(p, data[10:110]) {
+			t.Errorf("ReadAt of a cached chunk = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadAt of a cached chunk waited for another read's request")
+	}
+	unblock()
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests != 2 {
+		t.Errorf("%d requests, want 2", r.Requests)
+	}
+}
+
+func TestHTTPReaderFileChanged(t *testing.T) {
+	versions := [][]byte{make([]byte, 8<<10), make([]byte, 8<<10)}
+	rand.New(rand.NewSource(1)).Read(versions[0])
+	rand.New(rand.NewSource(2)).Read(versions[1])
+	version := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, version))
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(versions[version]))
+	}))
+	defer srv.Close()
+	r, err := OpenHTTP(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.ChunkSize = 1024
+	p := make([]byte, 100)
+	if _, err := r.ReadAt(p, 0); err != nil || !bytes.Equal(p, versions[0][:100]) {
+		t.Fatalf("ReadAt = %v", err)
+	}
+	// Reads of the replaced file fail, rather than returning its data.
+	version = 1
+	if _, err := r.ReadAt(p, 4096); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("ReadAt of a replaced file = %v, want a file changed error", err)
+	}
+}
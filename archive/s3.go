@@ -0,0 +1,378 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultS3PartSize is the default size of the parts of S3 multipart
+// uploads. S3 requires parts (but the last) to be at least 5 MiB.
+const DefaultS3PartSize = 16 << 20
+
+// S3Storage is a bucket of an S3-compatible object store. Requests are
+// signed with AWS Signature Version 4. Files are read with ranged GET
+// requests (see HTTPReader), and written with multipart uploads, so that
+// large archive files are not buffered entirely in memory.
+type S3Storage struct {
+	Bucket string
+	// Endpoint is the base URL of the object store, such as
+	// http://localhost:9000, whose objects are addressed as
+	// <Endpoint>/<bucket>/<key>. If empty, objects are addressed as
+	// https://<bucket>.s3.<region>.amazonaws.com/<key>.
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PartSize is the size of the parts of multipart uploads. Files
+	// smaller than PartSize are uploaded with a single request.
+	PartSize int
+	Client   *http.Client
+}
+
+// NewS3StorageFromEnv returns the storage for bucket, configured from the
+// standard AWS environment variables: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION (or
+// AWS_DEFAULT_REGION, defaulting to us-east-1) and AWS_ENDPOINT_URL.
+func NewS3StorageFromEnv(bucket string) (*S3Storage, error) {
+	s := &S3Storage{
+		Bucket:       bucket,
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		Region:       os.Getenv("AWS_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		PartSize:     DefaultS3PartSize,
+		Client:       http.DefaultClient,
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("s3://%s: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set", bucket)
+	}
+	return s, nil
+}
+
+// uriEncode percent-encodes s as required by Signature Version 4, keeping
+// slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectURL returns the URL of the object key, with the query parameters
+// (whose names must not need encoding) in canonical order.
+func (s *S3Storage) objectURL(key string, query map[string]string) string {
+	var u string
+	if s.Endpoint != "" {
+		u = strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + uriEncode(key, false)
+	} else {
+		u = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.Bucket, s.Region, uriEncode(key, false))
+	}
+	if len(query) == 0 {
+		return u
+	}
+	names := make([]string, 0, len(query))
+	for k := range query {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, k := range names {
+		params[i] = k + "=" + uriEncode(query[k], true)
+	}
+	return u + "?" + strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds Signature Version 4 authentication to a request with the given
+// payload. The request URL must be built by objectURL, so that its path and
+// query are in canonical form.
+func (s *S3Storage) sign(req *http.Request, payload []byte) {
+	s.signAt(req, payload, time.Now())
+}
+
+func (s *S3Storage) signAt(req *http.Request, payload []byte, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	crsum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(crsum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a signed request for the object key, and returns the response
+// body. Error responses, including errors reported in the body of a 200
+// response, are returned as errors.
+func (s *S3Storage) do(method, key string, query map[string]string, body []byte) (http.Header, []byte, error) {
+	return s.doContext(context.Background(), method, key, query, body)
+}
+
+// doContext is like do, with a context for the request.
+func (s *S3Storage) doContext(ctx context.Context, method, key string, query map[string]string, body []byte) (http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	s.sign(req, body)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("s3://%s/%s: %s", s.Bucket, key, err)
+	}
+	var e s3Error
+	if resp.StatusCode/100 != 2 || (bytes.Contains(b, []byte("<Error>")) && xml.Unmarshal(b, &e) == nil) {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil, fmt.Errorf("s3://%s/%s: %w", s.Bucket, key, os.ErrNotExist)
+		}
+		if e.Code == "" {
+			xml.Unmarshal(b, &e)
+		}
+		return nil, nil, fmt.Errorf("s3://%s/%s: %s %s: %s", s.Bucket, key, method, resp.Status, e.Code+" "+e.Message)
+	}
+	return resp.Header, b, nil
+}
+
+// Open implements Storage.
+func (s *S3Storage) Open(name string) (StorageReader, error) {
+	return openHTTP(s.Client, s.objectURL(name, nil), s.sign)
+}
+
+// Create implements Storage.
+func (s *S3Storage) Create(name string, force bool) (StorageWriter, error) {
+	if !force {
+		_, _, err := s.do(http.MethodHead, name, nil, nil)
+		if err == nil {
+			return nil, fmt.Errorf("output file s3://%s/%s already exists (use -force to overwrite)", s.Bucket, name)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &s3Writer{s: s, key: name, ctx: ctx, cancel: cancel}, nil
+}
+
+// errS3Aborted is returned by the writes to an aborted s3Writer.
+var errS3Aborted = errors.New("upload aborted")
+
+// s3Writer uploads a file in parts of s.PartSize, with a multipart upload
+// started when the first part is complete. Only the data of an incomplete
+// part is buffered. Abort can be called concurrently with the other methods,
+// and cancels the request in progress.
+type s3Writer struct {
+	s   *S3Storage
+	key string
+	// ctx is canceled by Abort.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	buf      []byte
+	uploadID string
+	parts    []s3Part
+	done     bool
+	err      error
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	if len(w.buf) > 0 {
+		k := w.s.PartSize - len(w.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		if len(w.buf) < w.s.PartSize {
+			return n, nil
+		}
+		if w.err = w.uploadPart(w.buf); w.err != nil {
+			return 0, w.err
+		}
+		w.buf = w.buf[:0]
+	}
+	// Whole parts are uploaded from p, without copying them.
+	for len(p) >= w.s.PartSize {
+		if w.err = w.uploadPart(p[:w.s.PartSize]); w.err != nil {
+			return 0, w.err
+		}
+		p = p[w.s.PartSize:]
+	}
+	w.buf = append(w.buf, p...)
+	return n, nil
+}
+
+func (w *s3Writer) uploadPart(b []byte) error {
+	if w.uploadID == "" {
+		_, body, err := w.s.doContext(w.ctx, http.MethodPost, w.key, map[string]string{"uploads": ""}, nil)
+		if err != nil {
+			return err
+		}
+		var res struct{ UploadId string }
+		if err := xml.Unmarshal(body, &res); err != nil || res.UploadId == "" {
+			return fmt.Errorf("s3://%s/%s: invalid response to multipart upload creation", w.s.Bucket, w.key)
+		}
+		w.uploadID = res.UploadId
+	}
+	n := len(w.parts) + 1
+	h, _, err := w.s.doContext(w.ctx, http.MethodPut, w.key, map[string]string{
+		"partNumber": strconv.Itoa(n),
+		"uploadId":   w.uploadID,
+	}, b)
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, s3Part{PartNumber: n, ETag: h.Get("ETag")})
+	return nil
+}
+
+// Commit implements StorageWriter.
+func (w *s3Writer) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		w.abort()
+		return w.err
+	}
+	if w.uploadID == "" {
+		_, _, err := w.s.doContext(w.ctx, http.MethodPut, w.key, nil, w.buf)
+		w.done = err == nil
+		return err
+	}
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(w.buf); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+	if _, _, err := w.s.doContext(w.ctx, http.MethodPost, w.key, map[string]string{"uploadId": w.uploadID}, body); err != nil {
+		w.abort()
+		return err
+	}
+	w.done = true
+	return nil
+}
+
+// Abort implements StorageWriter. A committed file is kept.
+func (w *s3Writer) Abort() {
+	w.cancel()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.abort()
+}
+
+// abort aborts the multipart upload, if any. w.mu must be held.
+func (w *s3Writer) abort() {
+	if w.done {
+		return
+	}
+	if w.uploadID != "" {
+		// The writer's context may be canceled.
+		w.s.do(http.MethodDelete, w.key, map[string]string{"uploadId": w.uploadID}, nil)
+		w.uploadID = ""
+	}
+	w.buf = nil
+	if w.err == nil {
+		w.err = errS3Aborted
+	}
+}
@@ -0,0 +1,291 @@
+package archive
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/henridf/eip44s-proto/spec"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Sizes breaks down the ssz-encoded size of blocks. Offsets of
+// variable-size list elements are counted with the element.
+type Sizes struct {
+	Headers      int `json:"headers"`
+	Transactions int `json:"transactions"`
+	Uncles       int `json:"uncles"`
+	// Receipts includes Logs.
+	Receipts int `json:"receipts"`
+	Logs     int `json:"logs"`
+	// Other is the remaining encoding overhead (block and list offsets).
+	Other int `json:"other"`
+	Total int `json:"total"`
+}
+
+// Stats describes the content of a range of blocks: an archive or a single
+// block.
+type Stats struct {
+	FirstBlock uint64 `json:"first_block"`
+	LastBlock  uint64 `json:"last_block"`
+	Blocks     int    `json:"blocks"`
+	Size       Sizes  `json:"size"`
+	// CompressedSize estimates compressibility: each field is the zstd
+	// compressed size of the concatenated encodings counted in Size (Other
+	// is not estimated).
+	CompressedSize Sizes          `json:"compressed_size"`
+	Transactions   int            `json:"transactions"`
+	TxTypes        map[string]int `json:"tx_types"`
+	Logs           int            `json:"logs"`
+	GasUsed        uint64         `json:"gas_used"`
+}
+
+// AvgGasUsed returns the average gas used per block.
+func (s *Stats) AvgGasUsed() float64 {
+	if s.Blocks == 0 {
+		return 0
+	}
+	return float64(s.GasUsed) / float64(s.Blocks)
+}
+
+// CompressionRatio returns the ratio of the encoded size to its compressed
+// size.
+func (s *Stats) CompressionRatio() float64 {
+	if s.CompressedSize.Total == 0 {
+		return 0
+	}
+	return float64(s.Size.Total) / float64(s.CompressedSize.Total)
+}
+
+// TxTypeName returns the name used in Stats.TxTypes for an EIP-2718
+// transaction type.
+func TxTypeName(t uint8) string {
+	switch t {
+	case 0:
+		return "legacy"
+	case 1:
+		return "access_list"
+	case 2:
+		return "dynamic_fee"
+	}
+	return fmt.Sprintf("type_%d", t)
+}
+
+// TxType returns the EIP-2718 type of an encoded transaction, as stored in
+// spec.Block.Transactions.
+func TxType(tx []byte) uint8 {
+	// Legacy transactions are rlp lists, typed transactions start with
+	// their type byte.
+	if len(tx) == 0 || tx[0] >= 0xc0 {
+		return 0
+	}
+	return tx[0]
+}
+
+// ArchiveStats computes the content statistics of an archive. Encodings are
+// compressed as a stream while blocks are added, so that they are not held in
+// memory.
+func ArchiveStats(arc spec.ArchiveBody) (*Stats, error) {
+	c := newStatsCollector(func() compressor {
+		w := &countingWriter{}
+		enc, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		return &streamCompressor{enc: enc, w: w}
+	})
+	for _, b := range arc.Blocks {
+		if err := c.add(b); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c.finish(arc.SizeSSZ())
+}
+
+// BlockStats computes the content statistics of a single block. Encodings
+// are compressed with an encoder shared by all calls.
+func BlockStats(b *spec.Block) (*Stats, error) {
+	c := newStatsCollector(func() compressor { return &bufferCompressor{} })
+	if err := c.add(b); err != nil {
+		return nil, err
+	}
+	return c.finish(b.SizeSSZ())
+}
+
+// A compressor estimates the compressed size of the data written to it.
+type compressor interface {
+	Write(p []byte) (int, error)
+	// CompressedSize completes the compression, and returns the compressed
+	// size.
+	CompressedSize() (int, error)
+}
+
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+type streamCompressor struct {
+	enc     *zstd.Encoder
+	w       *countingWriter
+	written bool
+}
+
+func (c *streamCompressor) Write(p []byte) (int, error) {
+	c.written = c.written || len(p) > 0
+	return c.enc.Write(p)
+}
+
+func (c *streamCompressor) CompressedSize() (int, error) {
+	if err := c.enc.Close(); err != nil {
+		return 0, err
+	}
+	if !c.written {
+		return 0, nil
+	}
+	return c.w.n, nil
+}
+
+var (
+	sharedEncoderOnce sync.Once
+	sharedEncoder     *zstd.Encoder
+)
+
+// bufferCompressor compresses small amounts of data, with EncodeAll on a
+// shared encoder.
+type bufferCompressor struct {
+	buf []byte
+}
+
+func (c *bufferCompressor) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	return len(p), nil
+}
+
+func (c *bufferCompressor) CompressedSize() (int, error) {
+	if len(c.buf) == 0 {
+		return 0, nil
+	}
+	sharedEncoderOnce.Do(func() {
+		sharedEncoder, _ = zstd.NewWriter(nil)
+	})
+	return len(sharedEncoder.EncodeAll(c.buf, nil)), nil
+}
+
+// Parts of the block encodings compressed by statsCollector.
+const (
+	partHeaders = iota
+	partTxs
+	partUncles
+	partReceipts
+	partLogs
+	partAll
+	numParts
+)
+
+type statsCollector struct {
+	s     Stats
+	parts [numParts]compressor
+	buf   []byte
+}
+
+func newStatsCollector(newCompressor func() compressor) *statsCollector {
+	c := &statsCollector{}
+	for i := range c.parts {
+		c.parts[i] = newCompressor()
+	}
+	return c
+}
+
+// marshal writes the ssz encoding of v to a part.
+func (c *statsCollector) marshal(part int, number uint64, v interface {
+	MarshalSSZTo([]byte) ([]byte, error)
+}) error {
+	var err error
+	if c.buf, err = v.MarshalSSZTo(c.buf[:0]); err != nil {
+		return fmt.Errorf("block %d: %s", number, err)
+	}
+	_, err = c.parts[part].Write(c.buf)
+	return err
+}
+
+func (c *statsCollector) add(b *spec.Block) error {
+	s := &c.s
+	if s.Blocks == 0 {
+		s.FirstBlock = b.Header.BlockNumber
+		s.TxTypes = make(map[string]int)
+	}
+	n := b.Header.BlockNumber
+	s.LastBlock = n
+	s.Blocks++
+	s.GasUsed += b.Header.GasUsed
+
+	if err := c.marshal(partHeaders, n, b.Header); err != nil {
+		return err
+	}
+	s.Size.Headers += b.Header.SizeSSZ()
+	for _, tx := range b.Transactions {
+		if _, err := c.parts[partTxs].Write(tx); err != nil {
+			return err
+		}
+		s.Size.Transactions += 4 + len(tx)
+		s.Transactions++
+		s.TxTypes[TxTypeName(TxType(tx))]++
+	}
+	for _, u := range b.Uncles {
+		if err := c.marshal(partUncles, n, u); err != nil {
+			return err
+		}
+		s.Size.Uncles += 4 + u.SizeSSZ()
+	}
+	for _, r := range b.Receipts {
+		if err := c.marshal(partReceipts, n, r); err != nil {
+			return err
+		}
+		s.Size.Receipts += 4 + r.SizeSSZ()
+		for _, l := range r.Logs {
+			if err := c.marshal(partLogs, n, l); err != nil {
+				return err
+			}
+			s.Size.Logs += 4 + l.SizeSSZ()
+			s.Logs++
+		}
+	}
+	return c.marshal(partAll, n, b)
+}
+
+// close releases the compressors of an unfinished collection.
+func (c *statsCollector) close() {
+	for _, p := range c.parts {
+		p.CompressedSize()
+	}
+}
+
+// finish completes the statistics, given the total encoded size.
+func (c *statsCollector) finish(total int) (*Stats, error) {
+	s := &c.s
+	s.Size.Total = total
+	s.Size.Other = total - s.Size.Headers - s.Size.Transactions - s.Size.Uncles - s.Size.Receipts
+
+	var sizes [numParts]int
+	var ferr error
+	for i, p := range c.parts {
+		var err error
+		if sizes[i], err = p.CompressedSize(); err != nil && ferr == nil {
+			ferr = err
+		}
+	}
+	if ferr != nil {
+		return nil, ferr
+	}
+	s.CompressedSize = Sizes{
+		Headers:      sizes[partHeaders],
+		Transactions: sizes[partTxs],
+		Uncles:       sizes[partUncles],
+		Receipts:     sizes[partReceipts],
+		Logs:         sizes[partLogs],
+		Total:        sizes[partAll],
+	}
+	return s, nil
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func TestStats(t *testing.T) {
+	// Block i of the test chain has i%4 transactions: legacy, access list
+	// and dynamic fee, of which all but the first emit a log. Block 5 has an
+	// uncle.
+	arc := testArchive(t, 8)
+	typed := *arc.Blocks[0]
+	typed.Transactions = [][]byte{{3, 1, 2, 3}}
+	for _, tt := range []struct {
+		name    string
+		blocks  []*spec.Block
+		first   uint64
+		txs     int
+		txTypes map[string]int
+		logs    int
+		gasUsed uint64
+	}{
+		{"archive", arc.Blocks, 0, 12, map[string]int{"legacy": 6, "access_list": 4, "dynamic_fee": 2}, 6, 6*21000 + 6*50000},
+		{"range", arc.Blocks[4:], 4, 6, map[string]int{"legacy": 3, "access_list": 2, "dynamic_fee": 1}, 3, 3*21000 + 3*50000},
+		{"block", arc.Blocks[3:4], 3, 3, map[string]int{"legacy": 1, "access_list": 1, "dynamic_fee": 1}, 2, 121000},
+		{"empty block", arc.Blocks[:1], 0, 0, map[string]int{}, 0, 0},
+		{"other type", []*spec.Block{&typed}, 0, 1, map[string]int{"type_3": 1}, 0, 0},
+	} {
+		body := spec.ArchiveBody{Blocks: tt.blocks}
+		s, err := ArchiveStats(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(kind string, s *Stats, total int) {
+			t.Helper()
+			last := tt.first + uint64(len(tt.blocks)) - 1
+			if s.Blocks != len(tt.blocks) || s.FirstBlock != tt.first || s.LastBlock != last {
+				t.Errorf("%s %s: blocks %d-%d (%d), want %d-%d", tt.name, kind, s.FirstBlock, s.LastBlock, s.Blocks, tt.first, last)
+			}
+			if s.Transactions != tt.txs || !reflect.DeepEqual(s.TxTypes, tt.txTypes) || s.Logs != tt.logs || s.GasUsed != tt.gasUsed {
+				t.Errorf("%s %s: %d transactions %v, %d logs, %d gas; want %d %v, %d, %d",
+					tt.name, kind, s.Transactions, s.TxTypes, s.Logs, s.GasUsed, tt.txs, tt.txTypes, tt.logs, tt.gasUsed)
+			}
+			// The sizes are those of the encodings, with their offsets.
+			var want Sizes
+			for _, b := range tt.blocks {
+				want.Headers += b.Header.SizeSSZ()
+				for _, tx := range b.Transactions {
+					want.Transactions += 4 + len(tx)
+				}
+				for _, u := range b.Uncles {
+					want.Uncles += 4 + u.SizeSSZ()
+				}
+				for _, r := range b.Receipts {
+					want.Receipts += 4 + r.SizeSSZ()
+					for _, l := range r.Logs {
+						want.Logs += 4 + l.SizeSSZ()
+					}
+				}
+			}
+			want.Total = total
+			want.Other = total - want.Headers - want.Transactions - want.Uncles - want.Receipts
+			if s.Size != want {
+				t.Errorf("%s %s: sizes %+v, want %+v", tt.name, kind, s.Size, want)
+			}
+			c := s.CompressedSize
+			if c.Headers == 0 || c.Total == 0 || (c.Transactions == 0) != (want.Transactions == 0) ||
+				(c.Uncles == 0) != (want.Uncles == 0) || (c.Receipts == 0) != (want.Receipts == 0) || (c.Logs == 0) != (want.Logs == 0) {
+				t.Errorf("%s %s: compressed sizes %+v for sizes %+v", tt.name, kind, c, want)
+			}
+		}
+		check("archive", s, body.SizeSSZ())
+		if len(tt.blocks) == 1 {
+			bs, err := BlockStats(tt.blocks[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("block", bs, tt.blocks[0].SizeSSZ())
+		}
+	}
+}
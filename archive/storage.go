@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Storage is a place archive files are read from and written to, such as the
+// local filesystem or an S3 bucket. Names are paths within the storage,
+// separated by slashes.
+type Storage interface {
+	// Open opens the named file for (random access) reading.
+	Open(name string) (StorageReader, error)
+	// Create creates the named file. The file only appears under its name
+	// once the writer is committed. Unless force is set, Create fails if
+	// the file already exists.
+	Create(name string, force bool) (StorageWriter, error)
+}
+
+// StorageReader is a file opened for reading by a Storage.
+type StorageReader interface {
+	io.ReaderAt
+	io.Closer
+	// Size returns the size of the file.
+	Size() int64
+}
+
+// StorageWriter is a file being written to a Storage, see OutputFile.
+type StorageWriter interface {
+	io.Writer
+	// Commit completes the file, making it visible under its name.
+	Commit() error
+	// Abort discards the file.
+	Abort()
+}
+
+// IsURL reports whether name is a storage URL, with a file://, s3://,
+// http:// or https:// scheme, rather than a local path.
+func IsURL(name string) bool {
+	for _, scheme := range []string{"file://", "s3://", "http://", "https://"} {
+		if strings.HasPrefix(name, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStorageURL returns the storage holding the file (or directory)
+// designated by a URL, and its name within the storage:
+//
+//	/path, file:///path            the local filesystem, and /path
+//	s3://bucket/key                an S3 bucket (see S3Storage), and key
+//	http://host/path, https://...  a read-only HTTP server, and the URL
+func ParseStorageURL(u string) (Storage, string, error) {
+	if !IsURL(u) {
+		return LocalStorage{}, u, nil
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, "", err
+	}
+	switch pu.Scheme {
+	case "file":
+		if pu.Host != "" && pu.Host != "localhost" {
+			return nil, "", fmt.Errorf("%s: file URLs must not have a host", u)
+		}
+		return LocalStorage{}, pu.Path, nil
+	case "s3":
+		if pu.Host == "" {
+			return nil, "", fmt.Errorf("%s: missing bucket", u)
+		}
+		s, err := NewS3StorageFromEnv(pu.Host)
+		if err != nil {
+			return nil, "", err
+		}
+		return s, strings.TrimPrefix(pu.Path, "/"), nil
+	default:
+		return HTTPStorage{}, u, nil
+	}
+}
+
+// ReadObject reads the whole named file from a storage.
+func ReadObject(s Storage, name string) ([]byte, error) {
+	r, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b := make([]byte, r.Size())
+	if _, err := r.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteObject writes b to the named file of a storage.
+func WriteObject(s Storage, name string, b []byte, force bool) error {
+	w, err := s.Create(name, force)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+// LocalStorage is the local filesystem. Files are written through
+// OutputFile.
+type LocalStorage struct{}
+
+type localReader struct {
+	*os.File
+	size int64
+}
+
+func (r *localReader) Size() int64 {
+	return r.size
+}
+
+// Open implements Storage.
+func (LocalStorage) Open(name string) (StorageReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &localReader{File: f, size: st.Size()}, nil
+}
+
+// Create implements Storage.
+func (LocalStorage) Create(name string, force bool) (StorageWriter, error) {
+	return CreateOutput(name, force)
+}
+
+// HTTPStorage reads files from HTTP servers, with HTTPReader. Names are
+// URLs. It cannot write files.
+type HTTPStorage struct{}
+
+// Open implements Storage.
+func (HTTPStorage) Open(name string) (StorageReader, error) {
+	return OpenHTTP(name)
+}
+
+// Create implements Storage.
+func (HTTPStorage) Create(name string, force bool) (StorageWriter, error) {
+	return nil, fmt.Errorf("%s: cannot write to HTTP storage", name)
+}
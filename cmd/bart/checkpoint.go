@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+const checkpointName = "checkpoint.json"
+
+// checkpoint records the progress of an rlp to ssz conversion, so that an
+// interrupted conversion can be resumed with -resume. It is updated after
+// each output file is completely written.
+type checkpoint struct {
+	Inputs []inputFile `json:"inputs"`
+	// Index, File, FirstBlock and LastBlock describe the last completed
+	// output file.
+	Index      int    `json:"index"`
+	File       string `json:"file"`
+	FirstBlock uint64 `json:"first_block"`
+	LastBlock  uint64 `json:"last_block"`
+	// InputOffset is the offset in the (concatenated) input files at which
+	// the next output file starts, and InputBuffered the number of bytes
+	// after it that had been read ahead (see archive.Archive.Buffered).
+	InputOffset   int64 `json:"input_offset"`
+	InputBuffered int   `json:"input_buffered"`
+	Complete      bool  `json:"complete"`
+}
+
+// inputFile identifies an input file of a conversion, so that a conversion is
+// only resumed with the same, unchanged, inputs. Size and ModTime are zero for
+// URLs.
+type inputFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func statInputs(names []string) ([]inputFile, error) {
+	inputs := make([]inputFile, len(names))
+	for i, fn := range names {
+		inputs[i].Name = fn
+		if fn == "-" || archive.IsURL(fn) {
+			continue
+		}
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i].Size = fi.Size()
+		inputs[i].ModTime = fi.ModTime()
+	}
+	return inputs, nil
+}
+
+func readCheckpoint(dir string) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, checkpointName))
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("unmarshalling checkpoint: %s", err)
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint file in dir, within store.
+func writeCheckpoint(store archive.Storage, dir string, cp *checkpoint) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return archive.WriteObject(store, filepath.Join(dir, checkpointName), append(b, '\n'), true)
+}
+
+// checkResume verifies that a checkpoint was written for the same inputs,
+// which have not changed since.
+func (cp *checkpoint) checkResume(inputs []inputFile) error {
+	if len(cp.Inputs) != len(inputs) {
+		return fmt.Errorf("checkpoint has %d input files, got %d", len(cp.Inputs), len(inputs))
+	}
+	for i, in := range inputs {
+		saved := cp.Inputs[i]
+		if filepath.Base(saved.Name) != filepath.Base(in.Name) {
+			return fmt.Errorf("checkpoint input %d is %s, got %s", i, saved.Name, in.Name)
+		}
+		if saved.Size != in.Size || !saved.ModTime.Equal(in.ModTime) {
+			return fmt.Errorf("input %s changed since the checkpoint (size %d, modified %s; was %d, %s)",
+				in.Name, in.Size, in.ModTime.Format(time.RFC3339), saved.Size, saved.ModTime.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// interruptHandler stops a conversion on SIGINT or SIGTERM. The first signal
+// lets the output file being written complete, and the conversion then stops.
+// A second signal aborts the output file being written, removing its
+// temporary file (or multipart upload), and exits immediately.
+type interruptHandler struct {
+	mu      sync.Mutex
+	current archive.StorageWriter
+}
+
+func handleInterrupts(stop func()) *interruptHandler {
+	h := &interruptHandler{}
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "Interrupted, finishing current output file (interrupt again to abort)")
+		stop()
+		<-sigs
+		h.mu.Lock()
+		if h.current != nil {
+			h.current.Abort()
+		}
+		bail(fmt.Errorf("aborted"))
+	}()
+	return h
+}
+
+// writing records the output file being written (or nil when done), which is
+// aborted if the conversion is aborted.
+func (h *interruptHandler) writing(w archive.StorageWriter) {
+	h.mu.Lock()
+	h.current = w
+	h.mu.Unlock()
+}
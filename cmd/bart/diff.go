@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func diffCmd(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var all bool
+	fs.BoolVar(&all, "all", false, "report every differing field, instead of only the first")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart diff [-all] <a.ssz> <b.ssz>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	a := readArchive(fs.Arg(0))
+	b := readArchive(fs.Arg(1))
+
+	max := 1
+	if all {
+		max = 0
+	}
+	diffs, err := archive.Diff(a, b, max)
+	if err != nil {
+		diffTrouble(err)
+	}
+	if len(diffs) == 0 {
+		fmt.Println("archives are identical")
+		return
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	// Like diff(1), exit with status 1 when the inputs differ.
+	os.Exit(1)
+}
+
+// diffTrouble reports an error and exits with status 2, as diff(1) does, so
+// that errors are not mistaken for differences.
+func diffTrouble(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(2)
+}
+
+// readArchive reads and checks the archive file fn, exiting on error.
+func readArchive(fn string) spec.ArchiveBody {
+	file, err := archive.OpenInput(fn)
+	if err != nil {
+		diffTrouble(fmt.Errorf("opening file: %s", err))
+	}
+	defer file.Close()
+	_, arc, err := archive.Read(file)
+	if err != nil {
+		diffTrouble(fmt.Errorf("%s: %s", fn, err))
+	}
+	return arc
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func fetchCmd(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var from, to uint64
+	var dir string
+	var parallel int
+	fs.Uint64Var(&from, "from", 0, "first block to fetch")
+	fs.Uint64Var(&to, "to", math.MaxUint64, "last block to fetch (default: last archived block)")
+	fs.StringVar(&dir, "dir", ".", "local directory to place the files in")
+	fs.IntVar(&parallel, "parallel", 4, "number of files downloaded concurrently")
+	logcfg := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart fetch [-from N] [-to M] [-dir dir] [-parallel n] <base-url>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// Allow flags after the URL, as in 'bart fetch <base-url> -from N'.
+	if fs.NArg() > 1 {
+		base := fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+		args = append([]string{base}, fs.Args()...)
+	} else {
+		args = fs.Args()
+	}
+	if len(args) != 1 || from > to {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log, err := logcfg.logger()
+	if err != nil {
+		bail(err)
+	}
+
+	_, err = archive.Fetch(args[0], dir, archive.FetchOptions{
+		FromBlock: from,
+		ToBlock:   to,
+		Parallel:  parallel,
+		FileFetched: func(e *spec.ManifestEntry, resumed int64, skipped bool) {
+			if skipped {
+				log.Info().Str("file", string(e.Name)).Msg("Already present and valid")
+				return
+			}
+			log.Info().Str("event", "file_fetched").
+				Str("file", string(e.Name)).
+				Uint64("first_block", e.HeadBlockNumber).
+				Uint64("last_block", e.HeadBlockNumber+uint64(e.BlockCount)-1).
+				Uint64("bytes", e.Size).
+				Int64("resumed_at", resumed).
+				Msg("Fetched and verified archive file")
+		},
+	})
+	if err != nil {
+		bail(err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+func getCmd(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	var number int64
+	var raw bool
+	fs.Int64Var(&number, "n", -1, "number of the block to get")
+	fs.BoolVar(&raw, "raw", false, "write the ssz encoding of the block to stdout, instead of printing it")
+	network := networkFlag(fs)
+	logcfg := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart get -n <block> [-raw] [-network name] <url>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if number < 0 || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log, err := logcfg.logger()
+	if err != nil {
+		bail(err)
+	}
+	url := fs.Arg(0)
+
+	r, err := archive.OpenHTTP(url)
+	if err != nil {
+		bail(err)
+	}
+	br, err := archive.NewRemoteBlockReader(r)
+	if err != nil {
+		bail(err)
+	}
+	i, ok := br.Index(uint64(number))
+	if !ok {
+		bail(fmt.Errorf("%s holds blocks %d to %d", url, br.Header.HeadBlockNumber, br.Header.HeadBlockNumber+uint64(br.Len())-1))
+	}
+	if raw {
+		b, err := br.BlockBytes(i)
+		if err != nil {
+			bail(err)
+		}
+		if _, err := os.Stdout.Write(b); err != nil {
+			bail(err)
+		}
+	} else {
+		sb, err := br.Block(i)
+		if err != nil {
+			bail(err)
+		}
+		printBlock(sb, networkConfig(*network))
+	}
+	log.Debug().Int("requests", r.Requests).Int64("bytes", r.Bytes).Int64("size", r.Size()).Msg("Fetched block")
+}
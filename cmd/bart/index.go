@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+// indexFlags adds the flags locating an archive directory and its hash index.
+func indexFlags(fs *flag.FlagSet) (dir, index *string) {
+	dir = fs.String("dir", ".", "archive directory, with a manifest")
+	index = fs.String("index", "", "hash index directory (default <dir>/"+archive.HashIndexName+")")
+	return dir, index
+}
+
+func openHashIndex(dir, index string) *archive.HashIndex {
+	if index == "" {
+		index = filepath.Join(dir, archive.HashIndexName)
+	}
+	ix, err := archive.OpenHashIndex(index, dir)
+	if err != nil {
+		bail(err)
+	}
+	return ix
+}
+
+func indexCmd(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	var addresses bool
+	fs.BoolVar(&addresses, "addresses", false, "also build the address activity index (recovers all transaction senders)")
+	network := networkFlag(fs)
+	logcfg := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart index [-dir dir] [-index dir] [-addresses [-network name]]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log, err := logcfg.logger()
+	if err != nil {
+		bail(err)
+	}
+	m, err := archive.ReadManifest(filepath.Join(*dir, archive.ManifestJSONName))
+	if err != nil {
+		bail(fmt.Errorf("reading manifest: %s", err))
+	}
+	sender := networkSender(*network)
+	ix := openHashIndex(*dir, *index)
+	defer ix.Close()
+	for _, e := range m.Files {
+		if addresses {
+			done, err := ix.AddressesIndexed(e)
+			if err != nil {
+				bail(err)
+			}
+			if !done {
+				if err := ix.AddFileAddresses(e, sender); err != nil {
+					bail(err)
+				}
+				log.Info().Str("event", "file_indexed").
+					Str("file", string(e.Name)).
+					Str("index", "addresses").
+					Msg("Indexed addresses of archive file")
+			}
+		}
+		done, err := ix.Indexed(e)
+		if err != nil {
+			bail(err)
+		}
+		if done {
+			log.Debug().Str("file", string(e.Name)).Msg("Already indexed")
+			continue
+		}
+		if err := ix.AddFile(e); err != nil {
+			bail(err)
+		}
+		log.Info().Str("event", "file_indexed").
+			Str("file", string(e.Name)).
+			Uint64("first_block", e.HeadBlockNumber).
+			Uint64("last_block", e.HeadBlockNumber+uint64(e.BlockCount)-1).
+			Msg("Indexed archive file")
+	}
+}
+
+func parseHash(s string) common.Hash {
+	b, err := decodeHex(s, common.HashLength)
+	if err != nil {
+		bail(err)
+	}
+	return common.BytesToHash(b)
+}
+
+func blockCmd(args []string) {
+	fs := flag.NewFlagSet("block", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	network := networkFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart block [-dir dir] [-index dir] [-network name] <block hash>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	hash := parseHash(fs.Arg(0))
+	cfg := networkConfig(*network)
+
+	ix := openHashIndex(*dir, *index)
+	defer ix.Close()
+	b, ok, err := ix.BlockByHash(hash)
+	if err != nil {
+		bail(err)
+	}
+	if !ok {
+		bail(fmt.Errorf("block %s not found", hash))
+	}
+	printBlock(b, cfg)
+}
+
+func txCmd(args []string) {
+	fs := flag.NewFlagSet("tx", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	network := networkFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart tx [-dir dir] [-index dir] [-network name] <transaction hash>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	hash := parseHash(fs.Arg(0))
+	cfg := networkConfig(*network)
+
+	ix := openHashIndex(*dir, *index)
+	defer ix.Close()
+	number, i, ok, err := ix.TxLocation(hash)
+	if err != nil {
+		bail(err)
+	}
+	if !ok {
+		bail(fmt.Errorf("transaction %s not found", hash))
+	}
+	sb, ok, err := ix.Block(number)
+	if err == nil && !ok {
+		err = fmt.Errorf("block %d not found", number)
+	}
+	if err != nil {
+		bail(err)
+	}
+	block, receipts, err := sb.ToTypesWithConfig(cfg)
+	if err != nil {
+		bail(fmt.Errorf("converting block: %s", err))
+	}
+	if i >= len(block.Transactions()) {
+		bail(fmt.Errorf("block %d has no transaction %d", number, i))
+	}
+	fmt.Printf("Block %d (%s)\n", number, block.Hash())
+	fmt.Printf("Transaction\n")
+	printTx(i, block.Transactions()[i], number, archive.SenderFunc(cfg))
+	if i < len(receipts) {
+		fmt.Printf("Receipt\n")
+		printReceipt(i, receipts[i])
+	}
+}
+
+func addressCmd(args []string) {
+	fs := flag.NewFlagSet("address", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	var from, to uint64
+	fs.Uint64Var(&from, "from", 0, "first block to report")
+	fs.Uint64Var(&to, "to", math.MaxUint64, "last block to report")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart address [-dir dir] [-index dir] [-from n] [-to n] <address>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	b, err := decodeHex(fs.Arg(0), common.AddressLength)
+	if err != nil {
+		bail(err)
+	}
+
+	ix := openHashIndex(*dir, *index)
+	defer ix.Close()
+	blocks, err := ix.AddressBlocks(common.BytesToAddress(b), from, to)
+	if err != nil {
+		bail(err)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, n := range blocks {
+		fmt.Fprintln(w, n)
+	}
+}
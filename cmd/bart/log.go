@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Logs go to stderr, so that archive or rlp output written to stdout can be
+// piped. Events that tooling may want to follow carry an "event" field:
+//
+//	archive_read   an archive's worth of rlp input was read (bytes, blocks)
+//	file_written   an output file was written (file, index, first_block, last_block, bytes, root)
+//	file_read      an input archive file was read (file, first_block, last_block)
+type logConfig struct {
+	format  string
+	quiet   bool
+	verbose bool
+}
+
+func addLogFlags(fs *flag.FlagSet) *logConfig {
+	c := &logConfig{}
+	fs.StringVar(&c.format, "log-format", "console", "log format [console,json]")
+	fs.BoolVar(&c.quiet, "quiet", false, "only log errors")
+	fs.BoolVar(&c.verbose, "v", false, "verbose (debug) logging")
+	return c
+}
+
+func (c *logConfig) logger() (zerolog.Logger, error) {
+	var out io.Writer
+	switch c.format {
+	case "console":
+		cw := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+		cw.FormatLevel = func(i interface{}) string {
+			return strings.ToUpper(fmt.Sprintf("| %-6s|", i))
+		}
+		cw.FormatFieldName = func(i interface{}) string {
+			return fmt.Sprintf("%s:", i)
+		}
+		out = cw
+	case "json":
+		out = os.Stderr
+	default:
+		return zerolog.Logger{}, fmt.Errorf("invalid log format %q", c.format)
+	}
+	if c.quiet && c.verbose {
+		return zerolog.Logger{}, fmt.Errorf("-quiet and -v are mutually exclusive")
+	}
+	level := zerolog.InfoLevel
+	if c.quiet {
+		level = zerolog.ErrorLevel
+	} else if c.verbose {
+		level = zerolog.DebugLevel
+	}
+	return zerolog.New(out).Level(level).With().Timestamp().Logger(), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+// hexList is a flag holding a list of hex values, given as comma-separated
+// values and/or by repeating the flag.
+type hexList struct {
+	size   int
+	values [][]byte
+}
+
+func (l *hexList) String() string {
+	var s []string
+	for _, v := range l.values {
+		s = append(s, hexutil.Encode(v))
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *hexList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		b, err := decodeHex(strings.TrimSpace(s), l.size)
+		if err != nil {
+			return err
+		}
+		l.values = append(l.values, b)
+	}
+	return nil
+}
+
+// decodeHex decodes a 0x-prefixed hex value of the given size.
+func decodeHex(s string, size int) ([]byte, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex value %q: %s", s, err)
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("invalid value %q: expected %d bytes", s, size)
+	}
+	return b, nil
+}
+
+func logsCmd(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	var from, to uint64
+	addresses := &hexList{size: common.AddressLength}
+	var topics [4]*hexList
+	fs.Uint64Var(&from, "from", 0, "first block to search")
+	fs.Uint64Var(&to, "to", math.MaxUint64, "last block to search")
+	fs.Var(addresses, "address", "only return logs emitted by these addresses (comma-separated or repeated)")
+	for i := range topics {
+		topics[i] = &hexList{size: common.HashLength}
+		fs.Var(topics[i], fmt.Sprintf("topic%d", i), fmt.Sprintf("only return logs with one of these topics at position %d (comma-separated or repeated)", i))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart logs [-address A] [-topic0 T ...] [-from n] [-to n] <file.ssz>...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	f := archive.LogFilter{FromBlock: from, ToBlock: to}
+	for _, a := range addresses.values {
+		f.Addresses = append(f.Addresses, common.BytesToAddress(a))
+	}
+	// The filter has a position for each topic flag up to the last given
+	// one. As with eth_getLogs, a wildcard position still requires logs to
+	// have a topic there, so positions after the last flag are left out.
+	n := 0
+	for i, t := range topics {
+		if len(t.values) > 0 {
+			n = i + 1
+		}
+	}
+	for _, t := range topics[:n] {
+		var sub []common.Hash
+		for _, v := range t.values {
+			sub = append(sub, common.BytesToHash(v))
+		}
+		f.Topics = append(f.Topics, sub)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+	err := archive.FilterLogs(fs.Args(), f, func(l *archive.FilteredLog) error {
+		return enc.Encode(l.ToTypes())
+	})
+	if err != nil {
+		w.Flush()
+		bail(err)
+	}
+}
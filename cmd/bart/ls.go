@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+// lsEntry is a line of bart ls JSON Lines output.
+type lsEntry struct {
+	Number       uint64 `json:"number"`
+	Hash         string `json:"hash"`
+	Timestamp    uint64 `json:"timestamp"`
+	Transactions int    `json:"transactions"`
+	GasUsed      uint64 `json:"gas_used"`
+	Receipts     int    `json:"receipts"`
+	Size         int    `json:"size"`
+}
+
+func lsCmd(args []string) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	var from, to uint64
+	var jsonl bool
+	fs.Uint64Var(&from, "from", 0, "first block to list")
+	fs.Uint64Var(&to, "to", math.MaxUint64, "last block to list")
+	fs.BoolVar(&jsonl, "json", false, "print JSON Lines output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart ls [-from n] [-to n] [-json] <file.ssz>...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	err := listBlocks(w, fs.Args(), from, to, jsonl)
+	// Rows listed before an error are still printed.
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		bail(err)
+	}
+}
+
+// listBlocks writes a line for each block from-to in the archive files.
+func listBlocks(w io.Writer, files []string, from, to uint64, jsonl bool) error {
+	enc := json.NewEncoder(w)
+	if !jsonl {
+		fmt.Fprintf(w, "%10s  %-66s  %-20s  %5s  %10s  %8s  %10s\n", "NUMBER", "HASH", "TIMESTAMP", "TXS", "GAS_USED", "RECEIPTS", "SIZE")
+	}
+	for _, fn := range files {
+		if err := listFile(w, enc, fn, from, to, jsonl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listFile(w io.Writer, enc *json.Encoder, fn string, from, to uint64, jsonl bool) error {
+	br, err := archive.OpenBlockReader(fn)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	first := br.Header.HeadBlockNumber
+	last := first + uint64(br.Len()) - 1
+	if last < from || first > to {
+		return nil
+	}
+	lo, hi := 0, br.Len()-1
+	if from > first {
+		lo = int(from - first)
+	}
+	if to < last {
+		hi = int(to - first)
+	}
+	for i := lo; i <= hi; i++ {
+		s, err := br.Summary(i)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+		h, err := s.Header.ToTypes()
+		if err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+		e := lsEntry{
+			Number:       s.Header.BlockNumber,
+			Hash:         h.Hash().Hex(),
+			Timestamp:    s.Header.Timestamp,
+			Transactions: s.Transactions,
+			GasUsed:      s.Header.GasUsed,
+			Receipts:     s.Receipts,
+			Size:         s.Size,
+		}
+		if jsonl {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			continue
+		}
+		ts := time.Unix(int64(e.Timestamp), 0).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, "%10d  %-66s  %-20s  %5d  %10d  %8d  %10d\n", e.Number, e.Hash, ts, e.Transactions, e.GasUsed, e.Receipts, e.Size)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+func TestListBlocks(t *testing.T) {
+	files := writeArchiveFiles(t, 30, 10)
+	blocks, _ := testchain.Generate(30)
+	for _, tt := range []struct {
+		from, to uint64
+		want     []uint64
+	}{
+		{0, 2, []uint64{0, 1, 2}},
+		{8, 12, []uint64{8, 9, 10, 11, 12}},
+		{29, 100, []uint64{29}},
+		{30, 100, nil},
+	} {
+		var buf bytes.Buffer
+		if err := listBlocks(&buf, files, tt.from, tt.to, true); err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var e map[string]interface{}
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for k := range e {
+				keys = append(keys, k)
+			}
+			if len(keys) != 7 {
+				t.Errorf("JSON line has fields %v", keys)
+			}
+			var le lsEntry
+			b, _ := json.Marshal(e)
+			if err := json.Unmarshal(b, &le); err != nil {
+				t.Fatal(err)
+			}
+			want := blocks[le.Number]
+			if le.Hash != want.Hash().Hex() || le.Timestamp != want.Time() || le.GasUsed != want.GasUsed() ||
+				le.Transactions != len(want.Transactions()) || le.Receipts != len(want.Transactions()) || le.Size == 0 {
+				t.Errorf("block %d: %+v", le.Number, le)
+			}
+			got = append(got, le.Number)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("-from %d -to %d: listed %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+
+		// The table lists the same blocks, after a header line.
+		buf.Reset()
+		if err := listBlocks(&buf, files, tt.from, tt.to, false); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if !strings.HasPrefix(strings.TrimSpace(lines[0]), "NUMBER") || len(lines) != len(tt.want)+1 {
+			t.Errorf("-from %d -to %d: table\n%s", tt.from, tt.to, buf.String())
+			continue
+		}
+		for i, n := range tt.want {
+			if f := strings.Fields(lines[i+1]); f[0] != fmt.Sprint(n) || f[1] != blocks[n].Hash().Hex() {
+				t.Errorf("table line %q, want block %d", lines[i+1], n)
+			}
+		}
+	}
+}
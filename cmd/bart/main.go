@@ -1,18 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"time"
 
-	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/henridf/eip44s-proto/archive"
 	"github.com/henridf/eip44s-proto/spec"
-	"github.com/rs/zerolog"
 )
 
 func bail(err error) {
@@ -26,52 +25,74 @@ func usage(err error) {
 	os.Exit(1)
 }
 
-func multiReader(filenames []string) (io.Reader, error) {
-	var readers []io.Reader
-	for i := 0; i < len(filenames); i++ {
-		fh, err := os.Open(filenames[i])
-		if err != nil {
-			return nil, err
-		}
-		readers = append(readers, fh)
-	}
-	return io.MultiReader(readers...), nil
-}
-
-func numberedFileName(basename string, n int) string {
-	suffix := filepath.Ext(basename)
-	name := strings.TrimSuffix(basename, suffix)
-	name = name + fmt.Sprintf("-%d", n) + suffix
-	return name
+// commands maps subcommand names to their entry points. Invoking bart without
+// a subcommand runs the conversion.
+var commands = map[string]func(args []string){
+	"convert":        convertCmd,
+	"address":        addressCmd,
+	"check-manifest": checkManifestCmd,
+	"block":          blockCmd,
+	"diff":           diffCmd,
+	"fetch":          fetchCmd,
+	"get":            getCmd,
+	"index":          indexCmd,
+	"logs":           logsCmd,
+	"ls":             lsCmd,
+	"p2p":            p2pCmd,
+	"serve":          serveCmd,
+	"show":           showCmd,
+	"stats":          statsCmd,
+	"tx":             txCmd,
 }
 
-func logger() zerolog.Logger {
-	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
-	output.FormatLevel = func(i interface{}) string {
-		return strings.ToUpper(fmt.Sprintf("| %-6s|", i))
-	}
-	output.FormatFieldName = func(i interface{}) string {
-		return fmt.Sprintf("%s:", i)
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
 	}
-	return zerolog.New(output).With().Timestamp().Logger()
+	convertCmd(os.Args[1:])
 }
 
-func main() {
+func convertCmd(args []string) {
 	var ifmt string
 	var ofmt = "ssz"
 	var output string
 	var hash bool
 	var info bool
 	var targetSize int
+	var outdir string
+	var nameTemplate string
+	var network string
+	var workers int
+	var inFlight int
+	var rootCache bool
+	var resume bool
+	var force bool
+	var progressInterval time.Duration
+	var metricsAddr string
 
 	flag.StringVar(&ofmt, "o", "ssz", "format for output data [rlp,rlprc,ssz], where rlp is the standard RLP block encoding and rlprc is rlp with interleaved receipts")
 	flag.StringVar(&ifmt, "i", "ssz", "format of input data [rlp,rlprc,ssz]")
 	flag.StringVar(&output, "f", "", "write data to given output file (default stdout)")
 	flag.IntVar(&targetSize, "targetsize", 0, "target output size (approximate) when encoding from rlp to ssz. Results in multiple sequential ssz files. Set '0' to slurp all data into one output file.")
+	flag.StringVar(&outdir, "dir", "", "directory to write output files to")
+	flag.StringVar(&nameTemplate, "name", "", "template for ssz output file names, with placeholders {network}, {index}, {first}, {last} and {root}, e.g. '{network}-{first:08d}-{last:08d}-{root:8}.ssz'")
+	flag.StringVar(&network, "network", "mainnet", "network name used for {network} in -name templates")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "number of concurrent workers for rlp to ssz conversion")
+	flag.IntVar(&inFlight, "inflight", archive.DefaultInFlight, "maximum number of archives held in memory during rlp to ssz conversion")
 	flag.BoolVar(&hash, "hash", false, "compute ssz hash of block list (read only mode, no output is written)")
+	flag.BoolVar(&rootCache, "rootcache", false, "with -hash, read and update a sidecar cache of per-block roots (<file>.roots), so that only changed blocks are rehashed")
 	flag.BoolVar(&info, "info", false, "print block number info (read only mode, no output is written)")
+	flag.BoolVar(&force, "force", false, "overwrite existing output files")
+	flag.BoolVar(&resume, "resume", false, "resume an interrupted rlp to ssz conversion from the checkpoint in the output directory")
+
+	flag.DurationVar(&progressInterval, "progress", 10*time.Second, "interval between progress reports when converting rlp to ssz (0 to disable)")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve Prometheus-style conversion metrics on the given address (e.g. ':9100'), under /metrics")
+	logcfg := addLogFlags(flag.CommandLine)
 
-	flag.Parse()
+	flag.CommandLine.Parse(args)
 
 	if ifmt != "rlprc" && ifmt != "rlp" && ifmt != "ssz" {
 		usage(fmt.Errorf("invalid input format"))
@@ -90,44 +111,219 @@ func main() {
 		usage(fmt.Errorf("-targetsize too small"))
 	}
 
-	args := flag.Args()
+	if targetSize != 0 && output == "" && nameTemplate == "" {
+		usage(fmt.Errorf("-targetsize requires an output file (-f) or name template (-name), cannot split output to stdout"))
+	}
+	if nameTemplate != "" && ofmt != "ssz" {
+		usage(fmt.Errorf("-name is only supported for ssz output"))
+	}
+	if outdir != "" && output == "" && nameTemplate == "" {
+		usage(fmt.Errorf("-dir requires an output file (-f) or name template (-name)"))
+	}
+	// store holds the output files: -dir, or -f without -dir, can be a
+	// storage URL such as s3://bucket/prefix.
+	var store archive.Storage = archive.LocalStorage{}
+	if archive.IsURL(outdir) || archive.IsURL(output) {
+		if ofmt != "ssz" || hash || info {
+			usage(fmt.Errorf("output URLs are only supported for ssz output"))
+		}
+		if resume {
+			usage(fmt.Errorf("-resume requires a local output directory"))
+		}
+		var err error
+		if archive.IsURL(outdir) {
+			store, outdir, err = archive.ParseStorageURL(outdir)
+		} else if outdir == "" {
+			store, output, err = archive.ParseStorageURL(output)
+		} else {
+			err = fmt.Errorf("-f must be a file name when -dir is given")
+		}
+		if err != nil {
+			usage(err)
+		}
+	}
+	namer := archive.Namer{
+		Dir:      outdir,
+		Base:     output,
+		Template: nameTemplate,
+		Network:  network,
+		Numbered: targetSize > 0,
+	}
+	if err := namer.Validate(); err != nil {
+		usage(err)
+	}
+	if _, local := store.(archive.LocalStorage); local && outdir != "" {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			bail(fmt.Errorf("creating output directory: %s", err))
+		}
+	}
+
+	args = flag.Args()
 	if len(args) == 0 {
-		usage(fmt.Errorf("must pass a file name with either rlp or ssz-encoded blocks"))
+		usage(fmt.Errorf("must pass a file name with either rlp or ssz-encoded blocks, or '-' for stdin"))
+	}
+	stdin := 0
+	for _, a := range args {
+		if a == "-" {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		usage(fmt.Errorf("stdin ('-') can only be read once"))
+	}
+	if resume && (ifmt == "ssz" || (output == "" && nameTemplate == "") || stdin > 0) {
+		usage(fmt.Errorf("-resume requires rlp input from files and ssz output to files"))
 	}
 
-	log := logger()
+	log, err := logcfg.logger()
+	if err != nil {
+		usage(err)
+	}
 
 	if ifmt == "rlp" || ifmt == "rlprc" {
-		mr, err := multiReader(args)
+		dir := outdir
+		if dir == "" {
+			dir = filepath.Dir(output)
+		}
+		toFile := output != "" || nameTemplate != ""
+
+		// The files written are merged into the manifest of the output
+		// directory, which can describe files of earlier conversions.
+		manifest := &spec.Manifest{Version: spec.Version}
+		if toFile {
+			m, err := archive.ReadManifestFrom(store, dir)
+			if err == nil {
+				manifest = m
+			} else if !errors.Is(err, os.ErrNotExist) {
+				bail(fmt.Errorf("reading manifest: %s", err))
+			}
+		}
+		inputs, err := statInputs(args)
 		if err != nil {
 			bail(err)
 		}
-		reader := newChunkedRLPReader(mr, ifmt == "rlprc", targetSize, log)
-
-		done := false
-		exp := uint64(0)
-		for i := 0; !done; i++ {
-			arc, err := reader.readOneArchive()
-			if err == io.EOF {
-				done = true
+		cp := &checkpoint{Inputs: inputs, Index: -1}
+		if resume {
+			saved, err := readCheckpoint(dir)
+			if os.IsNotExist(err) {
+				log.Info().Msg("No checkpoint found, starting conversion from the beginning")
+				saved = cp
 			} else if err != nil {
-				bail(fmt.Errorf("reading RLP: %s", err))
+				bail(fmt.Errorf("reading checkpoint: %s", err))
+			}
+			cp = saved
+			if err := cp.checkResume(inputs); err != nil {
+				bail(fmt.Errorf("cannot resume: %s", err))
+			}
+			if cp.Complete {
+				log.Info().Msg("Conversion already complete")
+				os.Exit(0)
+			}
+			if cp.Index >= 0 && len(manifest.Files) < cp.Index+1 {
+				bail(fmt.Errorf("cannot resume: manifest has %d files, checkpoint has %d", len(manifest.Files), cp.Index+1))
+			}
+			log.Info().Str("event", "resume").Str("file", cp.File).Int64("offset", cp.InputOffset).Msg("Resuming conversion")
+		}
+
+		mr, err := archive.MultiReader(args, cp.InputOffset)
+		if err != nil {
+			bail(err)
+		}
+		total, err := archive.InputSize(args)
+		if err != nil {
+			bail(err)
+		}
+		prog := newProgress(total, cp.InputOffset)
+		if metricsAddr != "" {
+			serveMetrics(metricsAddr, prog, log)
+		}
+		if progressInterval > 0 {
+			done := make(chan struct{})
+			defer close(done)
+			go prog.log(log, progressInterval, done)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		interrupts := handleInterrupts(cancel)
+
+		opts := archive.Options{
+			Receipts:    ifmt == "rlprc",
+			TargetSize:  targetSize,
+			Workers:     workers,
+			InFlight:    inFlight,
+			FirstIndex:  cp.Index + 1,
+			StartOffset: cp.InputOffset,
+			Buffered:    cp.InputBuffered,
+			Hooks: archive.Hooks{
+				BytesRead:      prog.addBytesRead,
+				BlockConverted: prog.addBlock,
+				ArchiveRead: func(index, blocks, bytes int, final bool) {
+					msg := "Read one archive"
+					if final {
+						msg = "Read final archive"
+					}
+					log.Info().Str("event", "archive_read").Int("index", index).Int("bytes", bytes).Int("blocks", blocks).Msg(msg)
+				},
+				ArchiveEncoded: func(index, bytes int) {
+					log.Debug().Int("index", index).Int("bytes", bytes).Msg("Encoded archive")
+				},
+			},
+		}
+		if cp.Index >= 0 {
+			opts.NextBlock = cp.LastBlock + 1
+		}
+		err = archive.ConvertRLP(ctx, mr, opts, func(a *archive.Archive) error {
+			filename := ""
+			if toFile {
+				var err error
+				if filename, err = namer.Name(a.Index, a.Header, a.Root); err != nil {
+					return err
+				}
 			}
-			if exp > 0 && arc.Blocks[0].Header.BlockNumber != exp {
-				bail(fmt.Errorf("Non-consecutive blocks (%d, expected %d)", arc.Blocks[0].Header.BlockNumber, exp))
+			if err := writeSSZ(store, filename, a.Bytes, force || resume, interrupts); err != nil {
+				return fmt.Errorf("writing SSZ: %s", err)
 			}
-			exp = arc.Blocks[0].Header.BlockNumber + uint64(len(arc.Blocks))
-			archdr := spec.ArchiveHeader{
-				Version:         spec.Version,
-				HeadBlockNumber: arc.Blocks[0].Header.BlockNumber,
-				BlockCount:      uint32(len(arc.Blocks)),
+			prog.addFile(len(a.Bytes))
+			log.Info().Str("event", "file_written").
+				Str("file", filename).
+				Int("index", a.Index).
+				Uint64("first_block", a.Header.HeadBlockNumber).
+				Uint64("last_block", a.LastBlock()).
+				Int("bytes", len(a.Bytes)).
+				Hex("root", a.Root[:]).
+				Msg("Wrote SSZ archive")
+			if !toFile {
+				return nil
 			}
-			filename := output
-			if targetSize > 0 {
-				filename = numberedFileName(output, i)
+			archive.MergeManifest(manifest, []*spec.ManifestEntry{archive.NewManifestEntry(filename, a.Bytes, a.Header, a.Root)})
+			if err := archive.WriteManifestTo(store, dir, manifest); err != nil {
+				return fmt.Errorf("writing manifest: %s", err)
 			}
-			if err := writeSSZ(filename, arc, archdr); err != nil {
-				bail(fmt.Errorf("writing SSZ: %s", err))
+			cp.Index = a.Index
+			cp.File = filepath.Base(filename)
+			cp.FirstBlock = a.Header.HeadBlockNumber
+			cp.LastBlock = a.LastBlock()
+			cp.InputOffset = a.End
+			cp.InputBuffered = a.Buffered
+			if err := writeCheckpoint(store, dir, cp); err != nil {
+				return fmt.Errorf("writing checkpoint: %s", err)
+			}
+			return nil
+		})
+		if err == context.Canceled {
+			bail(fmt.Errorf("conversion interrupted, continue with -resume"))
+		}
+		if err != nil {
+			bail(err)
+		}
+		if toFile {
+			if err := archive.WriteManifestTo(store, dir, manifest); err != nil {
+				bail(fmt.Errorf("writing manifest: %s", err))
+			}
+			cp.Complete = true
+			if err := writeCheckpoint(store, dir, cp); err != nil {
+				bail(fmt.Errorf("writing checkpoint: %s", err))
 			}
 		}
 		os.Exit(0)
@@ -135,11 +331,11 @@ func main() {
 
 	// ifmt == "ssz"
 	if info {
-		file, err := os.Open(args[0])
+		file, err := archive.OpenInput(args[0])
 		if err != nil {
 			bail(fmt.Errorf("opening file: %s", err))
 		}
-		archdr, err := readSSZHeader(file)
+		archdr, err := archive.ReadHeader(file)
 		if err != nil {
 			bail(err)
 		}
@@ -154,28 +350,31 @@ func main() {
 		var fn string
 		fn, args = args[0], args[1:]
 
-		file, err := os.Open(fn)
+		file, err := archive.OpenInput(fn)
 		if err != nil {
 			bail(fmt.Errorf("opening file: %s", err))
 		}
 
-		log.Info().Str("name", fn).Msg("Reading SSZ archive file")
-		archdr, err := readSSZHeader(file)
-		if err != nil {
-			bail(err)
-		}
-
-		arc, err := readSSZBlocks(file)
+		log.Debug().Str("file", fn).Msg("Reading SSZ archive file")
+		archdr, arc, err := archive.Read(file)
+		file.Close()
 		if err != nil {
 			bail(err)
 		}
-		if err := checkArchive(arc, archdr); err != nil {
-			bail(fmt.Errorf("invalid archive: %s", err))
-		}
+		log.Info().Str("event", "file_read").
+			Str("file", fn).
+			Uint64("first_block", archdr.HeadBlockNumber).
+			Uint64("last_block", archdr.HeadBlockNumber+uint64(archdr.BlockCount)-1).
+			Msg("Read SSZ archive")
 		arcs = append(arcs, arc)
 
 		if hash {
-			h32, err := arc.HashTreeRoot()
+			var h32 [32]byte
+			if rootCache {
+				h32, err = archive.HashWithRootCache(fn, arc, workers)
+			} else {
+				h32, err = arc.HashTreeRootParallel(workers)
+			}
 			if err != nil {
 				bail(fmt.Errorf("computing hash: %s", err))
 			}
@@ -183,186 +382,37 @@ func main() {
 			os.Exit(0)
 		}
 	}
-	log.Info().Str("name", output).Msg("Writing RLP file")
-	if err := writeRLP(ofmt, output, arcs...); err != nil {
-		bail(fmt.Errorf("writing RLP: %s", err))
-	}
-}
-
-func checkArchive(arc spec.ArchiveBody, archdr spec.ArchiveHeader) error {
-	if arc.Blocks[0].Header.BlockNumber != archdr.HeadBlockNumber {
-		return fmt.Errorf("header has first block %d, but body has first block %d",
-			archdr.HeadBlockNumber, arc.Blocks[0].Header.BlockNumber)
-	}
-	if len(arc.Blocks) != int(archdr.BlockCount) {
-		return fmt.Errorf("header has block count %d, but body has %d blocks",
-			archdr.BlockCount, len(arc.Blocks))
+	if output != "" {
+		output = filepath.Join(outdir, output)
 	}
-	return nil
-}
-
-func writeSSZ(output string, arc spec.ArchiveBody, archdr spec.ArchiveHeader) error {
-	var w io.Writer
 	if output == "" {
-		w = os.Stdout
+		err = archive.WriteRLP(os.Stdout, ofmt == "rlprc", arcs...)
 	} else {
-		fh, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
-		if err != nil {
-			bail(fmt.Errorf("could not open output file %s: %s", output, err))
-		}
-		defer fh.Close()
-		w = fh
+		err = archive.WriteRLPFile(output, force, ofmt == "rlprc", arcs...)
 	}
-	b, err := archdr.MarshalSSZ()
 	if err != nil {
-		return fmt.Errorf("marshalling SSZ header: %s", err)
-	}
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("writing SSZ header ssz: %s", err)
-	}
-	if b, err = arc.MarshalSSZ(); err != nil {
-		return fmt.Errorf("marshalling SSZ body: %s", err)
-	}
-	if _, err = w.Write(b); err != nil {
-		return fmt.Errorf("writing SSZ body: %s", err)
+		bail(fmt.Errorf("writing RLP: %s", err))
 	}
-	return nil
+	log.Info().Str("event", "file_written").Str("file", output).Int("archives", len(arcs)).Msg("Wrote RLP file")
 }
 
-func writeRLP(ofmt string, output string, arcs ...spec.ArchiveBody) error {
-	var w io.Writer
+// writeSSZ writes an encoded archive file to output within store, or to
+// stdout if output is empty. The file is registered with interrupts while it
+// is written.
+func writeSSZ(store archive.Storage, output string, b []byte, force bool, interrupts *interruptHandler) error {
 	if output == "" {
-		w = os.Stdout
-	} else {
-		fh, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
-		if err != nil {
-			bail(fmt.Errorf("could not open output file %s: %s", output, err))
-		}
-		defer fh.Close()
-		w = fh
-	}
-	exp := uint64(0)
-	for i := 0; i < len(arcs); i++ {
-		arc := arcs[i]
-		if exp > 0 && arc.Blocks[0].Header.BlockNumber != exp {
-			bail(fmt.Errorf("Non-consecutive blocks (%d, expected %d)", arc.Blocks[0].Header.BlockNumber, exp))
-		}
-		exp = arc.Blocks[len(arc.Blocks)-1].Header.BlockNumber + 1
-		if err := writeArcRLP(w, arc, ofmt == "rlprc"); err != nil {
-			bail(fmt.Errorf("writing RLP: %s", err))
-		}
+		_, err := os.Stdout.Write(b)
+		return err
 	}
-	return nil
-}
-
-func writeArcRLP(w io.Writer, arc spec.ArchiveBody, receipts bool) error {
-	for i := 0; i < len(arc.Blocks); i++ {
-		var err error
-		if receipts {
-			err = rlp.Encode(w, arc.Blocks[i])
-		} else {
-			err = rlp.Encode(w, (*spec.BlockNoReceipts)(arc.Blocks[i]))
-		}
-		if err != nil {
-			return fmt.Errorf("writing RLP-encoded block: %s", err)
-		}
-	}
-	return nil
-}
-
-type countingReader struct {
-	r io.Reader
-	n int
-}
-
-func (cr *countingReader) Read(p []byte) (n int, err error) {
-	n, err = cr.r.Read(p)
-	cr.n += n
-	return n, err
-}
-
-type chunkedRLPReader struct {
-	stream     *rlp.Stream
-	receipts   bool
-	targetSize int
-	cr         *countingReader
-	log        zerolog.Logger
-}
-
-func newChunkedRLPReader(r io.Reader, receipts bool, targetSize int, log zerolog.Logger) *chunkedRLPReader {
-	cr := &countingReader{r: r}
-	stream := rlp.NewStream(cr, 0)
-	return &chunkedRLPReader{
-		stream,
-		receipts,
-		targetSize,
-		cr,
-		log,
-	}
-}
-
-func (c *chunkedRLPReader) readOneArchive() (spec.ArchiveBody, error) {
-	var blocks []*spec.Block
-	// xxx not checking maxblocks
-	var err error
-	for i := 0; true; i++ {
-		_, _, err = c.stream.Kind()
-		if err == io.EOF {
-			c.log.Info().Int("size (bytes)", c.cr.n).Msg("Read final archive")
-			break
-		}
-		if c.targetSize > 0 && c.cr.n >= c.targetSize {
-			c.log.Info().Int("size (bytes)", c.cr.n).Msg("Read one archive")
-			break
-		}
-		if err != nil {
-			break
-		}
-
-		var b spec.Block
-		if c.receipts {
-			err = c.stream.Decode(&b)
-			if err != nil && err != io.EOF {
-				return spec.ArchiveBody{}, fmt.Errorf("decoding RLP block %d: %v", i, err)
-			}
-		} else {
-			var bn spec.BlockNoReceipts
-			err = c.stream.Decode(&bn)
-			if err != nil && err != io.EOF {
-				return spec.ArchiveBody{}, fmt.Errorf("decoding RLP block %d: %v", i, err)
-			}
-			b = (spec.Block)(bn)
-		}
-		blocks = append(blocks, &b)
-	}
-	c.cr.n = 0
-	return spec.ArchiveBody{
-		Blocks: blocks,
-	}, err
-}
-
-func readSSZHeader(r io.Reader) (spec.ArchiveHeader, error) {
-	var h spec.ArchiveHeader
-	sz := h.SizeSSZ()
-	buf := make([]byte, sz)
-
-	if _, err := io.ReadFull(r, buf); err != nil {
-		return spec.ArchiveHeader{}, err
-	}
-	if err := h.UnmarshalSSZ(buf); err != nil {
-		return spec.ArchiveHeader{}, fmt.Errorf("unmarshalling ssz: %s", err)
-	}
-	return h, nil
-}
-
-func readSSZBlocks(r io.Reader) (spec.ArchiveBody, error) {
-	var blocks spec.ArchiveBody
-	b, err := ioutil.ReadAll(r)
+	w, err := store.Create(output, force)
 	if err != nil {
-		return blocks, fmt.Errorf("reading ssz file: %s", err)
+		return err
 	}
-	if err = blocks.UnmarshalSSZ(b); err != nil {
-		return blocks, fmt.Errorf("unmarshalling ssz: %s", err)
+	interrupts.writing(w)
+	defer interrupts.writing(nil)
+	if _, err := w.Write(b); err != nil {
+		w.Abort()
+		return err
 	}
-	return blocks, nil
+	return w.Commit()
 }
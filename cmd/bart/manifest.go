@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+func checkManifestCmd(args []string) {
+	fs := flag.NewFlagSet("check-manifest", flag.ExitOnError)
+	var path string
+	fs.StringVar(&path, "manifest", "", "manifest file, in JSON or SSZ form (default <dir>/"+archive.ManifestJSONName+")")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart check-manifest [-manifest file] <dir>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	dir := fs.Arg(0)
+	if path == "" {
+		path = filepath.Join(dir, archive.ManifestJSONName)
+	}
+	m, err := archive.ReadManifest(path)
+	if err != nil {
+		bail(fmt.Errorf("reading manifest: %s", err))
+	}
+
+	failed := 0
+	exp := uint64(0)
+	for i, e := range m.Files {
+		if i > 0 && e.HeadBlockNumber != exp {
+			fmt.Printf("%s: non-consecutive blocks (%d, expected %d)\n", e.Name, e.HeadBlockNumber, exp)
+			failed++
+		}
+		exp = e.HeadBlockNumber + uint64(e.BlockCount)
+		if err := archive.CheckFile(dir, e); err != nil {
+			fmt.Printf("%s: FAILED: %s\n", e.Name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: OK\n", e.Name)
+	}
+	if failed > 0 {
+		bail(fmt.Errorf("%d of %d manifest checks failed", failed, len(m.Files)))
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/server"
+)
+
+// loadNodeKey reads the node key from file, or generates it and saves it to
+// file if it does not exist, so that the node keeps its identity across
+// restarts. With an empty file name, a new key is generated.
+func loadNodeKey(file string) (*ecdsa.PrivateKey, error) {
+	if file == "" {
+		return crypto.GenerateKey()
+	}
+	key, err := crypto.LoadECDSA(file)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+	if key, err = crypto.GenerateKey(); err != nil {
+		return nil, err
+	}
+	return key, crypto.SaveECDSA(file, key)
+}
+
+func p2pCmd(args []string) {
+	fs := flag.NewFlagSet("p2p", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	network := networkFlag(fs)
+	var listen, nodeKeyFile, bootnodes, natSpec string
+	var maxPeers int
+	var networkID uint64
+	var noDiscover bool
+	fs.StringVar(&listen, "listen", ":30303", "devp2p listening address")
+	fs.StringVar(&nodeKeyFile, "nodekey", "", "node key file, created if it does not exist (default: a new key on each run)")
+	fs.IntVar(&maxPeers, "maxpeers", 50, "maximum number of peers")
+	fs.Uint64Var(&networkID, "networkid", 0, "network id (default the chain id of -network)")
+	fs.StringVar(&bootnodes, "bootnodes", "", "comma-separated enode URLs of the bootstrap nodes (default those of -network)")
+	fs.BoolVar(&noDiscover, "nodiscover", false, "disable peer discovery: only accept inbound connections, and dial the -bootnodes directly")
+	fs.StringVar(&natSpec, "nat", "any", "NAT port mapping mechanism [any,none,upnp,pmp,extip:<IP>]")
+	logcfg := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart p2p [-dir dir] [-index dir] [-network name] [-listen addr] [-nodekey file] [-bootnodes urls]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log, err := logcfg.logger()
+	if err != nil {
+		bail(err)
+	}
+	// Peers reject nodes whose fork id does not match the fork blocks of
+	// their network, so these must be known.
+	if *network == archive.AnyNetwork {
+		bail(fmt.Errorf("bart p2p requires a known -network"))
+	}
+	cfg, err := archive.ChainConfig(*network)
+	if err != nil {
+		bail(err)
+	}
+	if networkID == 0 {
+		networkID = cfg.ChainID.Uint64()
+	}
+	natm, err := nat.Parse(natSpec)
+	if err != nil {
+		bail(fmt.Errorf("invalid -nat: %s", err))
+	}
+	var urls []string
+	if !noDiscover {
+		urls = archive.Bootnodes(*network)
+	}
+	if bootnodes != "" {
+		urls = strings.Split(bootnodes, ",")
+	}
+	var nodes []*enode.Node
+	for _, u := range urls {
+		n, err := enode.Parse(enode.ValidSchemes, strings.TrimSpace(u))
+		if err != nil {
+			bail(fmt.Errorf("invalid bootnode %q: %s", u, err))
+		}
+		nodes = append(nodes, n)
+	}
+	key, err := loadNodeKey(nodeKeyFile)
+	if err != nil {
+		bail(fmt.Errorf("node key: %s", err))
+	}
+
+	m, err := archive.ReadManifest(filepath.Join(*dir, archive.ManifestJSONName))
+	if err != nil {
+		bail(fmt.Errorf("reading manifest: %s", err))
+	}
+	ix := openHashIndex(*dir, *index)
+	defer ix.Close()
+	genesis, _ := archive.GenesisHash(*network)
+	h, err := server.NewEthHandler(*dir, m, ix, cfg, networkID, genesis)
+	if err != nil {
+		bail(err)
+	}
+	defer h.Close()
+	h.PeerConnected = func(p *p2p.Peer) {
+		log.Info().Str("peer", p.ID().TerminalString()).Str("name", p.Fullname()).Str("addr", p.RemoteAddr().String()).Msg("Peer connected")
+	}
+	h.PeerDisconnected = func(p *p2p.Peer, err error) {
+		log.Info().Str("peer", p.ID().TerminalString()).Str("reason", fmt.Sprint(err)).Msg("Peer disconnected")
+	}
+
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		MaxPeers:    maxPeers,
+		Name:        "bart",
+		ListenAddr:  listen,
+		NoDiscovery: noDiscover,
+		Protocols:   h.Protocols(),
+		NAT:         natm,
+	}}
+	if noDiscover {
+		// Bootstrap nodes are only used by discovery.
+		srv.StaticNodes = nodes
+	} else {
+		srv.BootstrapNodes = nodes
+	}
+	if err := srv.Start(); err != nil {
+		bail(err)
+	}
+	fid := h.ForkID()
+	log.Info().Str("enode", srv.Self().URLv4()).Uint64("network_id", networkID).
+		Str("fork_id", fmt.Sprintf("%x/%d", fid.Hash, fid.Next)).Int("files", len(m.Files)).Msg("Serving history over devp2p")
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	<-sigs
+	log.Info().Msg("Shutting down")
+	srv.Stop()
+}
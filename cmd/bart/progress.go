@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// progress tracks a conversion for periodic progress logs and the metrics
+// endpoint. All methods are safe for concurrent use and on a nil *progress.
+type progress struct {
+	start       time.Time
+	totalBytes  int64
+	startOffset int64
+
+	bytesRead    int64 // absolute offset in the concatenated input
+	blocks       int64
+	block        uint64 // highest block number converted
+	files        int64
+	bytesWritten int64
+}
+
+func newProgress(totalBytes, startOffset int64) *progress {
+	return &progress{
+		start:       time.Now(),
+		totalBytes:  totalBytes,
+		startOffset: startOffset,
+		bytesRead:   startOffset,
+	}
+}
+
+func (p *progress) addBytesRead(n int) {
+	if p != nil {
+		atomic.AddInt64(&p.bytesRead, int64(n))
+	}
+}
+
+func (p *progress) addBlock(number uint64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.blocks, 1)
+	for {
+		cur := atomic.LoadUint64(&p.block)
+		if number <= cur || atomic.CompareAndSwapUint64(&p.block, cur, number) {
+			return
+		}
+	}
+}
+
+func (p *progress) addFile(bytes int) {
+	if p != nil {
+		atomic.AddInt64(&p.files, 1)
+		atomic.AddInt64(&p.bytesWritten, int64(bytes))
+	}
+}
+
+// log reports progress every interval, until quit is closed.
+func (p *progress) log(log zerolog.Logger, interval time.Duration, quit <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-quit:
+			return
+		}
+		elapsed := time.Since(p.start).Seconds()
+		read := atomic.LoadInt64(&p.bytesRead)
+		blocks := atomic.LoadInt64(&p.blocks)
+		mbps := float64(read-p.startOffset) / 1e6 / elapsed
+		ev := log.Info().Str("event", "progress").
+			Uint64("block", atomic.LoadUint64(&p.block)).
+			Int64("blocks", blocks).
+			Str("blocks/s", fmt.Sprintf("%.1f", float64(blocks)/elapsed)).
+			Str("MB/s", fmt.Sprintf("%.2f", mbps))
+		if p.totalBytes > 0 {
+			ev = ev.Str("percent", fmt.Sprintf("%.1f", 100*float64(read)/float64(p.totalBytes)))
+			if mbps > 0 {
+				eta := time.Duration(float64(p.totalBytes-read) / (mbps * 1e6) * float64(time.Second))
+				ev = ev.Str("eta", eta.Round(time.Second).String())
+			}
+		}
+		ev.Msg("Progress")
+	}
+}
+
+// ServeHTTP writes the conversion metrics in the Prometheus text format.
+func (p *progress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, typ, help string, v interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, v)
+	}
+	metric("bart_input_bytes", "gauge", "Total size of the input files.", p.totalBytes)
+	metric("bart_input_read_bytes", "gauge", "Offset reached in the input files.", atomic.LoadInt64(&p.bytesRead))
+	metric("bart_blocks_converted_total", "counter", "Blocks converted.", atomic.LoadInt64(&p.blocks))
+	metric("bart_current_block", "gauge", "Highest block number converted.", atomic.LoadUint64(&p.block))
+	metric("bart_files_written_total", "counter", "Output files written.", atomic.LoadInt64(&p.files))
+	metric("bart_written_bytes_total", "counter", "Bytes written to output files.", atomic.LoadInt64(&p.bytesWritten))
+	metric("bart_uptime_seconds", "gauge", "Time since the conversion started.", int64(time.Since(p.start).Seconds()))
+}
+
+// serveMetrics serves the metrics endpoint at addr, under /metrics.
+func serveMetrics(addr string, p *progress, log zerolog.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("Metrics server failed")
+		}
+	}()
+}
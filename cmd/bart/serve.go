@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/server"
+)
+
+func serveCmd(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dir, index := indexFlags(fs)
+	network := networkFlag(fs)
+	var rpcAddr, httpAddr string
+	var maxLogs int
+	fs.StringVar(&rpcAddr, "rpc", "", "serve historical eth_ JSON-RPC methods on the given address (e.g. ':8545')")
+	fs.StringVar(&httpAddr, "http", "", "serve archive files, blocks, headers and receipts on the given address (e.g. ':8080')")
+	fs.IntVar(&maxLogs, "max-logs", 10000, "maximum number of logs returned by eth_getLogs (0 for no limit)")
+	logcfg := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart serve [-dir dir] [-index dir] [-network name] [-rpc addr] [-http addr]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || (rpcAddr == "" && httpAddr == "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log, err := logcfg.logger()
+	if err != nil {
+		bail(err)
+	}
+	cfg, err := archive.ChainConfig(*network)
+	if err != nil {
+		bail(err)
+	}
+	m, err := archive.ReadManifest(filepath.Join(*dir, archive.ManifestJSONName))
+	if err != nil {
+		bail(fmt.Errorf("reading manifest: %s", err))
+	}
+	errc := make(chan error, 2)
+	if rpcAddr != "" {
+		ix := openHashIndex(*dir, *index)
+		defer ix.Close()
+		api, err := server.NewEthAPI(*dir, m, ix, cfg)
+		if err != nil {
+			bail(err)
+		}
+		defer api.Close()
+		api.MaxLogs = maxLogs
+		rpcServer, err := server.NewRPCServer(api)
+		if err != nil {
+			bail(err)
+		}
+		log.Info().Str("addr", rpcAddr).Int("files", len(m.Files)).Msg("Serving JSON-RPC")
+		go func() { errc <- http.ListenAndServe(rpcAddr, rpcServer) }()
+	}
+	if httpAddr != "" {
+		content, err := server.NewContentServer(*dir, m)
+		if err != nil {
+			bail(err)
+		}
+		defer content.Close()
+		log.Info().Str("addr", httpAddr).Int("files", len(m.Files)).Msg("Serving archive content")
+		go func() { errc <- http.ListenAndServe(httpAddr, content) }()
+	}
+	bail(<-errc)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+func showCmd(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	var number int64
+	fs.Int64Var(&number, "n", -1, "number of the block to show")
+	network := networkFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart show -n <block> [-network name] <file.ssz>...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if number < 0 || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cfg := networkConfig(*network)
+
+	sb, err := archive.ReadBlock(fs.Args(), uint64(number))
+	if err != nil {
+		bail(err)
+	}
+	printBlock(sb, cfg)
+}
+
+// senderFunc recovers transaction senders, see archive.SenderFunc.
+type senderFunc func(number uint64, tx *types.Transaction) (common.Address, error)
+
+// networkFlag adds the -network flag selecting the fork rules for sender
+// recovery.
+func networkFlag(fs *flag.FlagSet) *string {
+	return fs.String("network", "mainnet", "network of the archive, which selects the fork rules for recovering transaction senders [mainnet,ropsten,sepolia,rinkeby,goerli,any]")
+}
+
+// networkConfig returns the chain configuration of a network (nil for
+// "any"), exiting on error.
+func networkConfig(network string) *params.ChainConfig {
+	cfg, err := archive.ChainConfig(network)
+	if err != nil {
+		bail(err)
+	}
+	return cfg
+}
+
+func networkSender(network string) senderFunc {
+	return archive.SenderFunc(networkConfig(network))
+}
+
+func printBlock(sb *spec.Block, cfg *params.ChainConfig) {
+	sender := archive.SenderFunc(cfg)
+	block, receipts, err := sb.ToTypesWithConfig(cfg)
+	if err != nil {
+		bail(fmt.Errorf("converting block: %s", err))
+	}
+
+	fmt.Printf("Block %d\n", block.NumberU64())
+	printHeader("  ", block.Header())
+
+	fmt.Printf("Transactions (%d)\n", len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		printTx(i, tx, block.NumberU64(), sender)
+	}
+
+	fmt.Printf("Uncles (%d)\n", len(block.Uncles()))
+	for i, u := range block.Uncles() {
+		fmt.Printf("  [%d] %s\n", i, u.Hash())
+		printHeader("    ", u)
+	}
+
+	fmt.Printf("Receipts (%d)\n", len(receipts))
+	for i, r := range receipts {
+		printReceipt(i, r)
+	}
+}
+
+func printTx(i int, tx *types.Transaction, number uint64, sender senderFunc) {
+	fmt.Printf("  [%d] %s\n", i, tx.Hash())
+	fmt.Printf("    Type:       %d (%s)\n", tx.Type(), archive.TxTypeName(tx.Type()))
+	if from, err := sender(number, tx); err != nil {
+		fmt.Printf("    From:       (%s)\n", err)
+	} else {
+		fmt.Printf("    From:       %s\n", from)
+	}
+	if tx.To() == nil {
+		fmt.Printf("    To:         (contract creation)\n")
+	} else {
+		fmt.Printf("    To:         %s\n", tx.To())
+	}
+	fmt.Printf("    Value:      %s\n", tx.Value())
+	fmt.Printf("    Nonce:      %d\n", tx.Nonce())
+	fmt.Printf("    Gas:        %d\n", tx.Gas())
+	if tx.Type() == types.DynamicFeeTxType {
+		fmt.Printf("    MaxFee:     %s\n", tx.GasFeeCap())
+		fmt.Printf("    MaxTip:     %s\n", tx.GasTipCap())
+	} else {
+		fmt.Printf("    GasPrice:   %s\n", tx.GasPrice())
+	}
+	if tx.Protected() {
+		fmt.Printf("    ChainID:    %s\n", tx.ChainId())
+	}
+	if len(tx.AccessList()) > 0 {
+		fmt.Printf("    AccessList: %d addresses, %d storage keys\n", len(tx.AccessList()), tx.AccessList().StorageKeys())
+	}
+	fmt.Printf("    Data:       %d bytes\n", len(tx.Data()))
+}
+
+func printReceipt(i int, r *types.Receipt) {
+	fmt.Printf("  [%d] %s\n", i, r.TxHash)
+	if len(r.PostState) > 0 {
+		fmt.Printf("    PostState:         0x%x\n", r.PostState)
+	} else {
+		fmt.Printf("    Status:            %d\n", r.Status)
+	}
+	fmt.Printf("    CumulativeGasUsed: %d\n", r.CumulativeGasUsed)
+	fmt.Printf("    GasUsed:           %d\n", r.GasUsed)
+	if r.ContractAddress != (common.Address{}) {
+		fmt.Printf("    ContractAddress:   %s\n", r.ContractAddress)
+	}
+	fmt.Printf("    Logs (%d)\n", len(r.Logs))
+	for _, l := range r.Logs {
+		fmt.Printf("      [%d] %s\n", l.Index, l.Address)
+		for j, t := range l.Topics {
+			fmt.Printf("        Topic%d: %s\n", j, t)
+		}
+		fmt.Printf("        Data:   0x%x\n", l.Data)
+	}
+}
+
+func printHeader(indent string, h *types.Header) {
+	field := func(name string, v interface{}) {
+		fmt.Printf("%s%-13s %v\n", indent, name+":", v)
+	}
+	field("Hash", h.Hash())
+	field("ParentHash", h.ParentHash)
+	field("UncleHash", h.UncleHash)
+	field("Coinbase", h.Coinbase)
+	field("StateRoot", h.Root)
+	field("TxHash", h.TxHash)
+	field("ReceiptsRoot", h.ReceiptHash)
+	field("Difficulty", h.Difficulty)
+	field("Number", h.Number)
+	field("GasLimit", h.GasLimit)
+	field("GasUsed", h.GasUsed)
+	field("Timestamp", fmt.Sprintf("%d (%s)", h.Time, time.Unix(int64(h.Time), 0).UTC().Format(time.RFC3339)))
+	field("ExtraData", fmt.Sprintf("0x%x", h.Extra))
+	if h.BaseFee != nil {
+		field("BaseFee", h.BaseFee)
+	}
+	field("MixDigest", h.MixDigest)
+	field("Nonce", fmt.Sprintf("0x%x", h.Nonce[:]))
+}
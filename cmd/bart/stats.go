@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+var statsColumns = []string{
+	"file", "first_block", "last_block", "blocks",
+	"header_bytes", "tx_bytes", "uncle_bytes", "receipt_bytes", "log_bytes", "other_bytes", "total_bytes",
+	"zstd_bytes", "zstd_ratio",
+	"txs", "txs_legacy", "txs_access_list", "txs_dynamic_fee", "txs_other",
+	"logs", "avg_gas_used",
+}
+
+func statsRow(file string, s *archive.Stats) []string {
+	known := s.TxTypes["legacy"] + s.TxTypes["access_list"] + s.TxTypes["dynamic_fee"]
+	return []string{
+		file,
+		strconv.FormatUint(s.FirstBlock, 10),
+		strconv.FormatUint(s.LastBlock, 10),
+		strconv.Itoa(s.Blocks),
+		strconv.Itoa(s.Size.Headers),
+		strconv.Itoa(s.Size.Transactions),
+		strconv.Itoa(s.Size.Uncles),
+		strconv.Itoa(s.Size.Receipts),
+		strconv.Itoa(s.Size.Logs),
+		strconv.Itoa(s.Size.Other),
+		strconv.Itoa(s.Size.Total),
+		strconv.Itoa(s.CompressedSize.Total),
+		fmt.Sprintf("%.2f", s.CompressionRatio()),
+		strconv.Itoa(s.Transactions),
+		strconv.Itoa(s.TxTypes["legacy"]),
+		strconv.Itoa(s.TxTypes["access_list"]),
+		strconv.Itoa(s.TxTypes["dynamic_fee"]),
+		strconv.Itoa(s.Transactions - known),
+		strconv.Itoa(s.Logs),
+		fmt.Sprintf("%.0f", s.AvgGasUsed()),
+	}
+}
+
+// statsJSON is the JSON output of bart stats, one object per archive.
+type statsJSON struct {
+	File string `json:"file"`
+	*archive.Stats
+	Blocks []*archive.Stats `json:"block_stats,omitempty"`
+}
+
+func statsCmd(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var format string
+	var perBlock bool
+	fs.StringVar(&format, "format", "table", "output format [table,csv,json]")
+	fs.BoolVar(&perBlock, "per-block", false, "also report statistics for each block")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bart stats [-format table|csv|json] [-per-block] <file.ssz>...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	switch format {
+	case "table", "csv", "json":
+	default:
+		bail(fmt.Errorf("invalid output format %q", format))
+	}
+	w := bufio.NewWriter(os.Stdout)
+	err := writeStats(w, fs.Args(), format, perBlock)
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		bail(err)
+	}
+}
+
+// writeStats writes the statistics of the archive files in the given format.
+func writeStats(w io.Writer, files []string, format string, perBlock bool) error {
+	var rows [][]string
+	var enc *json.Encoder
+	if format == "json" {
+		enc = json.NewEncoder(w)
+	}
+
+	for _, fn := range files {
+		file, err := archive.OpenInput(fn)
+		if err != nil {
+			return fmt.Errorf("opening file: %s", err)
+		}
+		_, arc, err := archive.Read(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+		s, err := archive.ArchiveStats(arc)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+		out := statsJSON{File: fn, Stats: s}
+		rows = append(rows, statsRow(fn, s))
+		if perBlock {
+			for _, b := range arc.Blocks {
+				bs, err := archive.BlockStats(b)
+				if err != nil {
+					return fmt.Errorf("%s: %s", fn, err)
+				}
+				out.Blocks = append(out.Blocks, bs)
+				rows = append(rows, statsRow(fn, bs))
+			}
+		}
+		if enc != nil {
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(statsColumns, "\t"))+"\t")
+		for _, r := range rows {
+			fmt.Fprintln(tw, strings.Join(r, "\t")+"\t")
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(statsColumns)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// writeArchiveFiles writes n test chain blocks into archive files of per
+// blocks each, and returns their paths.
+func writeArchiveFiles(t *testing.T, n, per int) []string {
+	t.Helper()
+	blocks, receipts := testchain.Generate(n)
+	dir := t.TempDir()
+	var files []string
+	for first := 0; first < n; first += per {
+		var arc spec.ArchiveBody
+		for i := first; i < first+per && i < n; i++ {
+			sb, err := spec.NewBlock(blocks[i], receipts[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			arc.Blocks = append(arc.Blocks, sb)
+		}
+		b, err := archive.Encode(arc, spec.ArchiveHeader{
+			Version:         spec.Version,
+			HeadBlockNumber: uint64(first),
+			BlockCount:      uint32(len(arc.Blocks)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("test-%d.ssz", len(files)))
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestStatsJSON(t *testing.T) {
+	files := writeArchiveFiles(t, 20, 10)
+	for _, perBlock := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := writeStats(&buf, files, "json", perBlock); err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(&buf)
+		for i, fn := range files {
+			var out map[string]json.RawMessage
+			if err := dec.Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			var file string
+			var blocks, first int
+			json.Unmarshal(out["file"], &file)
+			json.Unmarshal(out["blocks"], &blocks)
+			json.Unmarshal(out["first_block"], &first)
+			if file != fn || blocks != 10 || first != 10*i {
+				t.Errorf("file %s, %d blocks from %d; want %s, 10 from %d", file, blocks, first, fn, 10*i)
+			}
+			for _, k := range []string{"last_block", "size", "compressed_size", "transactions", "tx_types", "logs", "gas_used"} {
+				if _, ok := out[k]; !ok {
+					t.Errorf("no %q in %s", k, fn)
+				}
+			}
+			// Per-block statistics are a list in block_stats, with the
+			// fields of the file statistics.
+			var perBlocks []map[string]json.RawMessage
+			if b, ok := out["block_stats"]; ok != perBlock {
+				t.Fatalf("-per-block %v: block_stats present: %v", perBlock, ok)
+			} else if ok {
+				if err := json.Unmarshal(b, &perBlocks); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if perBlock && len(perBlocks) != 10 {
+				t.Fatalf("%d block stats, want 10", len(perBlocks))
+			}
+			for j, bs := range perBlocks {
+				var blocks, first int
+				json.Unmarshal(bs["blocks"], &blocks)
+				json.Unmarshal(bs["first_block"], &first)
+				if blocks != 1 || first != 10*i+j {
+					t.Errorf("block stats %d: %d blocks from %d", j, blocks, first)
+				}
+				if _, ok := bs["file"]; ok {
+					t.Errorf("block stats %d have a file", j)
+				}
+			}
+		}
+		if dec.More() {
+			t.Error("more JSON values than files")
+		}
+	}
+}
+
+func TestStatsCSV(t *testing.T) {
+	files := writeArchiveFiles(t, 20, 10)
+	var buf bytes.Buffer
+	if err := writeStats(&buf, files, "csv", true); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+2*11 || strings.Join(rows[0], ",") != strings.Join(statsColumns, ",") {
+		t.Fatalf("%d rows, header %v", len(rows), rows[0])
+	}
+	// Blocks 0-9 hold 13 transactions, and 6 logs.
+	if r := rows[1]; r[0] != files[0] || r[1] != "0" || r[2] != "9" || r[3] != "10" || r[13] != "13" || r[18] != "6" {
+		t.Errorf("file row %v", r)
+	}
+	if r := rows[4]; r[1] != "2" || r[2] != "2" || r[3] != "1" || r[13] != "2" || r[14] != "1" || r[15] != "1" {
+		t.Errorf("block 2 row %v", r)
+	}
+}
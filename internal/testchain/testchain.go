@@ -0,0 +1,153 @@
+// Package testchain generates chains of blocks, with transactions, uncles,
+// receipts and logs, for tests.
+package testchain
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// Key signs the transactions of generated chains.
+	Key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	// Sender is the address of Key.
+	Sender = crypto.PubkeyToAddress(Key.PublicKey)
+	// LogAddress is the address of the contract emitting the logs of
+	// generated receipts, and Topic the first topic of these logs.
+	LogAddress = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	Topic      = crypto.Keccak256Hash([]byte("Ping(uint256)"))
+	// Config is the chain configuration of generated chains, with all forks
+	// active from the genesis.
+	Config = params.TestChainConfig
+)
+
+// Hasher is a types.TrieHasher that hashes the concatenation of list items,
+// standing in for the trie (whose package has many dependencies) when
+// deriving transaction and receipt roots.
+type Hasher struct {
+	buf bytes.Buffer
+}
+
+func (h *Hasher) Reset() {
+	h.buf.Reset()
+}
+
+func (h *Hasher) Update(key, value []byte) {
+	h.buf.Write(key)
+	h.buf.Write(value)
+}
+
+func (h *Hasher) Hash() common.Hash {
+	return crypto.Keccak256Hash(h.buf.Bytes())
+}
+
+// Generate returns a chain of n blocks, from the genesis, and their
+// receipts. Block i holds i%4 transactions of the legacy, access list and
+// dynamic fee types, transactions but the first emit a log, and every fifth
+// block has an uncle.
+func Generate(n int) ([]*types.Block, []types.Receipts) {
+	signer := types.LatestSignerForChainID(Config.ChainID)
+	blocks := make([]*types.Block, n)
+	receipts := make([]types.Receipts, n)
+	nonce := uint64(0)
+	for i := 0; i < n; i++ {
+		header := &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(131072),
+			GasLimit:   30000000,
+			Time:       uint64(1600000000 + 13*i),
+			Coinbase:   common.Address{byte(i)},
+			Extra:      []byte("testchain"),
+			BaseFee:    big.NewInt(1e9),
+		}
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		var txs types.Transactions
+		var rs types.Receipts
+		for j := 0; j < i%4; j++ {
+			tx := newTx(j, nonce, big.NewInt(int64(i)))
+			stx, err := types.SignTx(tx, signer, Key)
+			if err != nil {
+				panic(err)
+			}
+			nonce++
+			header.GasUsed += tx.Gas()
+			r := &types.Receipt{
+				Type:              stx.Type(),
+				Status:            types.ReceiptStatusSuccessful,
+				CumulativeGasUsed: header.GasUsed,
+				TxHash:            stx.Hash(),
+				GasUsed:           tx.Gas(),
+			}
+			if j > 0 {
+				r.Logs = []*types.Log{{
+					Address: LogAddress,
+					Topics:  []common.Hash{Topic, common.BigToHash(big.NewInt(int64(i)))},
+					Data:    []byte{byte(i), byte(j)},
+				}}
+			}
+			r.Bloom = types.CreateBloom(types.Receipts{r})
+			txs = append(txs, stx)
+			rs = append(rs, r)
+		}
+		var uncles []*types.Header
+		if i > 1 && i%5 == 0 {
+			uncles = append(uncles, &types.Header{
+				ParentHash: blocks[i-2].Hash(),
+				Number:     big.NewInt(int64(i - 1)),
+				Difficulty: big.NewInt(131072),
+				GasLimit:   30000000,
+				Time:       uint64(1600000000 + 13*(i-1) + 1),
+				Coinbase:   common.Address{0xff, byte(i)},
+				BaseFee:    big.NewInt(1e9),
+			})
+		}
+		blocks[i] = types.NewBlock(header, txs, uncles, rs, new(Hasher))
+		receipts[i] = rs
+	}
+	return blocks, receipts
+}
+
+func newTx(kind int, nonce uint64, value *big.Int) *types.Transaction {
+	to := common.Address{0xaa, byte(nonce)}
+	switch kind {
+	case 0:
+		return types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Value: value, Gas: 21000, GasPrice: big.NewInt(2e9)})
+	case 1:
+		return types.NewTx(&types.AccessListTx{ChainID: Config.ChainID, Nonce: nonce, To: &LogAddress, Gas: 50000, GasPrice: big.NewInt(2e9),
+			AccessList: types.AccessList{{Address: to, StorageKeys: []common.Hash{{1}}}}})
+	default:
+		return types.NewTx(&types.DynamicFeeTx{ChainID: Config.ChainID, Nonce: nonce, To: &LogAddress, Gas: 50000,
+			GasFeeCap: big.NewInt(3e9), GasTipCap: big.NewInt(1e9), Data: []byte{1, 2, 3}})
+	}
+}
+
+// RLPRC returns the rlprc encoding of a chain: each block is followed by its
+// receipts, in storage encoding. With receipts nil, it returns the plain rlp
+// encoding of the blocks.
+func RLPRC(blocks []*types.Block, receipts []types.Receipts) []byte {
+	var buf bytes.Buffer
+	for i, b := range blocks {
+		if err := rlp.Encode(&buf, b); err != nil {
+			panic(err)
+		}
+		if receipts == nil {
+			continue
+		}
+		rs := make([]*types.ReceiptForStorage, len(receipts[i]))
+		for j, r := range receipts[i] {
+			rs[j] = (*types.ReceiptForStorage)(r)
+		}
+		if err := rlp.Encode(&buf, rs); err != nil {
+			panic(err)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// testArchiveDir writes n test blocks to an archive directory, in files of
+// perFile blocks, along with its manifest and hash index.
+func testArchiveDir(t *testing.T, n, perFile int) (string, *spec.Manifest, *archive.HashIndex) {
+	t.Helper()
+	blocks, receipts := testchain.Generate(n)
+	dir := t.TempDir()
+	m := &spec.Manifest{}
+	for first := 0; first < n; first += perFile {
+		var arc spec.ArchiveBody
+		for i := first; i < n && i < first+perFile; i++ {
+			sb, err := spec.NewBlock(blocks[i], receipts[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			arc.Blocks = append(arc.Blocks, sb)
+		}
+		archdr := spec.ArchiveHeader{
+			Version:         spec.Version,
+			HeadBlockNumber: uint64(first),
+			BlockCount:      uint32(len(arc.Blocks)),
+		}
+		b, err := archive.Encode(arc, archdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := arc.HashTreeRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(dir, fmt.Sprintf("test-%d.ssz", len(m.Files)))
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m.Files = append(m.Files, archive.NewManifestEntry(name, b, archdr, root))
+	}
+	if err := archive.WriteManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := archive.OpenHashIndex(filepath.Join(dir, archive.HashIndexName), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	for _, e := range m.Files {
+		if err := ix.AddFile(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, m, ix
+}
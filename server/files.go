@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// archiveFiles gives access to the blocks of the files of an archive
+// directory, by block number. Files are opened on first access, and kept
+// open.
+type archiveFiles struct {
+	dir     string
+	m       *spec.Manifest
+	mu      sync.Mutex
+	readers map[string]*archive.BlockReader
+}
+
+func newArchiveFiles(dir string, m *spec.Manifest) *archiveFiles {
+	return &archiveFiles{dir: dir, m: m, readers: make(map[string]*archive.BlockReader)}
+}
+
+// reader returns a reader for the archive file of manifest entry e.
+func (f *archiveFiles) reader(e *spec.ManifestEntry) (*archive.BlockReader, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := string(e.Name)
+	br, ok := f.readers[name]
+	if !ok {
+		var err error
+		if br, err = archive.OpenBlockReader(filepath.Join(f.dir, name)); err != nil {
+			return nil, err
+		}
+		f.readers[name] = br
+	}
+	return br, nil
+}
+
+// blockReader returns the manifest entry and a reader for the archive file
+// holding block n, or a nil reader if no file holds it.
+func (f *archiveFiles) blockReader(n uint64) (*spec.ManifestEntry, *archive.BlockReader, error) {
+	for _, e := range f.m.Files {
+		if n < e.HeadBlockNumber || n-e.HeadBlockNumber >= uint64(e.BlockCount) {
+			continue
+		}
+		br, err := f.reader(e)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := br.Index(n); !ok {
+			return nil, nil, fmt.Errorf("%s does not hold block %d", e.Name, n)
+		}
+		return e, br, nil
+	}
+	return nil, nil, nil
+}
+
+// filterLogs calls fn, in order, for each archived log matching the filter
+// (see archive.FilterLogs). Only the files holding blocks in the filter range
+// are opened.
+func (f *archiveFiles) filterLogs(lf archive.LogFilter, fn func(l *archive.FilteredLog) error) error {
+	for _, e := range archive.FilesInRange(f.m, lf.FromBlock, lf.ToBlock) {
+		br, err := f.reader(e)
+		if err != nil {
+			return err
+		}
+		if err := archive.FilterReaderLogs(br, lf, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// header reads the header of block n, returning nil if it is not archived.
+func (f *archiveFiles) header(n uint64) (*spec.Header, error) {
+	_, br, err := f.blockReader(n)
+	if br == nil || err != nil {
+		return nil, err
+	}
+	i, _ := br.Index(n)
+	return br.BlockHeader(i)
+}
+
+// block reads block n, returning nil if it is not archived.
+func (f *archiveFiles) block(n uint64) (*spec.Block, error) {
+	_, br, err := f.blockReader(n)
+	if br == nil || err != nil {
+		return nil, err
+	}
+	i, _ := br.Index(n)
+	return br.Block(i)
+}
+
+// close closes the opened archive files.
+func (f *archiveFiles) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, br := range f.readers {
+		br.Close()
+		delete(f.readers, name)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// FilterCriteria are the eth_getLogs parameters. They are decoded as by geth
+// (eth/filters), without depending on the node packages.
+type FilterCriteria struct {
+	BlockHash *common.Hash
+	FromBlock *rpc.BlockNumber
+	ToBlock   *rpc.BlockNumber
+	Addresses []common.Address
+	Topics    [][]common.Hash
+}
+
+// UnmarshalJSON decodes filter criteria. The address can be a single
+// address or a list, and each topic position null (any topic), a topic, or a
+// list of alternative topics.
+func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
+	type input struct {
+		BlockHash *common.Hash     `json:"blockHash"`
+		FromBlock *rpc.BlockNumber `json:"fromBlock"`
+		ToBlock   *rpc.BlockNumber `json:"toBlock"`
+		Addresses interface{}      `json:"address"`
+		Topics    []interface{}    `json:"topics"`
+	}
+
+	var raw input
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.BlockHash != nil {
+		if raw.FromBlock != nil || raw.ToBlock != nil {
+			return fmt.Errorf("cannot specify both BlockHash and FromBlock/ToBlock, choose one or the other")
+		}
+		args.BlockHash = raw.BlockHash
+	} else {
+		args.FromBlock = raw.FromBlock
+		args.ToBlock = raw.ToBlock
+	}
+
+	args.Addresses = []common.Address{}
+	if raw.Addresses != nil {
+		switch rawAddr := raw.Addresses.(type) {
+		case []interface{}:
+			for i, addr := range rawAddr {
+				strAddr, ok := addr.(string)
+				if !ok {
+					return fmt.Errorf("non-string address at index %d", i)
+				}
+				a, err := decodeAddress(strAddr)
+				if err != nil {
+					return fmt.Errorf("invalid address at index %d: %v", i, err)
+				}
+				args.Addresses = append(args.Addresses, a)
+			}
+		case string:
+			a, err := decodeAddress(rawAddr)
+			if err != nil {
+				return fmt.Errorf("invalid address: %v", err)
+			}
+			args.Addresses = []common.Address{a}
+		default:
+			return errors.New("invalid addresses in query")
+		}
+	}
+
+	if len(raw.Topics) > 0 {
+		args.Topics = make([][]common.Hash, len(raw.Topics))
+		for i, t := range raw.Topics {
+			switch topic := t.(type) {
+			case nil:
+				// Any topic.
+			case string:
+				top, err := decodeTopic(topic)
+				if err != nil {
+					return err
+				}
+				args.Topics[i] = []common.Hash{top}
+			case []interface{}:
+				for _, rawTopic := range topic {
+					if rawTopic == nil {
+						// A null alternative matches any topic.
+						args.Topics[i] = nil
+						break
+					}
+					s, ok := rawTopic.(string)
+					if !ok {
+						return fmt.Errorf("invalid topic(s)")
+					}
+					parsed, err := decodeTopic(s)
+					if err != nil {
+						return err
+					}
+					args.Topics[i] = append(args.Topics[i], parsed)
+				}
+			default:
+				return fmt.Errorf("invalid topic(s)")
+			}
+		}
+	}
+	return nil
+}
+
+func decodeAddress(s string) (common.Address, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.AddressLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for address", len(b), common.AddressLength)
+	}
+	return common.BytesToAddress(b), err
+}
+
+func decodeTopic(s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.HashLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for topic", len(b), common.HashLength)
+	}
+	return common.BytesToHash(b), err
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// ContentServer serves an archive directory over HTTP:
+//
+//	/manifest.json, /manifest.ssz   the manifest
+//	/{name}                         the archive files listed in the manifest
+//	/block/{n}.ssz                  the ssz encoding of block n
+//	/header/{n}.ssz                 the ssz encoding of the header of block n
+//	/receipts/{n}.ssz               the ssz encoding of the receipts of block n
+//
+// Blocks, headers and receipts are sliced out of the archive files, without
+// decoding them. All resources support Range requests, and have an ETag
+// derived from the hash_tree_root of the manifest or of the archive file
+// holding them.
+type ContentServer struct {
+	dir   string
+	m     *spec.Manifest
+	files *archiveFiles
+	mjson []byte
+	mssz  []byte
+	mroot string
+}
+
+// NewContentServer returns a server for the archive directory dir, described
+// by manifest m.
+func NewContentServer(dir string, m *spec.Manifest) (*ContentServer, error) {
+	s := &ContentServer{dir: dir, m: m, files: newArchiveFiles(dir, m)}
+	var err error
+	if s.mjson, err = archive.MarshalManifestJSON(m); err != nil {
+		return nil, err
+	}
+	if s.mssz, err = m.MarshalSSZ(); err != nil {
+		return nil, err
+	}
+	root, err := m.HashTreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	s.mroot = hex.EncodeToString(root[:])
+	return s, nil
+}
+
+// Close closes the archive files opened to serve blocks.
+func (s *ContentServer) Close() error {
+	return s.files.close()
+}
+
+func (s *ContentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	// Archive files are matched first, so that no route shadows them.
+	if e := s.entry(path); e != nil {
+		s.serveFile(w, r, e)
+		return
+	}
+	switch {
+	case path == archive.ManifestJSONName:
+		s.serveBytes(w, r, path, "application/json", s.etag(s.mroot, "json"), s.mjson)
+	case path == archive.ManifestSSZName:
+		s.serveBytes(w, r, path, "application/octet-stream", s.etag(s.mroot, "ssz"), s.mssz)
+	case strings.Contains(path, "/"):
+		s.serveBlock(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// entry returns the manifest entry of the archive file name, or nil.
+func (s *ContentServer) entry(name string) *spec.ManifestEntry {
+	for _, e := range s.m.Files {
+		if string(e.Name) == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *ContentServer) etag(parts ...string) string {
+	return `"` + strings.Join(parts, "-") + `"`
+}
+
+func (s *ContentServer) serveBytes(w http.ResponseWriter, r *http.Request, name, ctype, etag string, b []byte) {
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+}
+
+func (s *ContentServer) serveFile(w http.ResponseWriter, r *http.Request, entry *spec.ManifestEntry) {
+	name := string(entry.Name)
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", s.etag(hex.EncodeToString(entry.Root)))
+	http.ServeContent(w, r, name, st.ModTime(), f)
+}
+
+// serveBlock serves the /block, /header and /receipts resources.
+func (s *ContentServer) serveBlock(w http.ResponseWriter, r *http.Request, path string) {
+	kind := path[:strings.Index(path, "/")]
+	num := strings.TrimSuffix(path[len(kind)+1:], ".ssz")
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || num+".ssz" != path[len(kind)+1:] {
+		http.NotFound(w, r)
+		return
+	}
+	var read func(br *archive.BlockReader, i int) ([]byte, error)
+	switch kind {
+	case "block":
+		read = (*archive.BlockReader).BlockBytes
+	case "header":
+		read = (*archive.BlockReader).HeaderBytes
+	case "receipts":
+		read = (*archive.BlockReader).ReceiptsBytes
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	e, br, err := s.files.blockReader(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if br == nil {
+		http.Error(w, fmt.Sprintf("block %d not found", n), http.StatusNotFound)
+		return
+	}
+	i, _ := br.Index(n)
+	b, err := read(br, i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.serveBytes(w, r, path, "application/octet-stream", s.etag(hex.EncodeToString(e.Root), kind, num), b)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/henridf/eip44s-proto/archive"
+)
+
+func TestContentServer(t *testing.T) {
+	dir, _, _ := testArchiveDir(t, 20, 10)
+	// Serve the manifest as read back, with validated file names.
+	m, err := archive.ReadManifest(filepath.Join(dir, archive.ManifestJSONName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewContentServer(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	e := m.Files[1]
+	name := string(e.Name)
+	file, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	br, err := archive.OpenBlockReader(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+	i, ok := br.Index(13)
+	if !ok {
+		t.Fatalf("%s does not hold block 13", name)
+	}
+	read := func(f func(*archive.BlockReader, int) ([]byte, error)) []byte {
+		b, err := f(br, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	mjson, err := archive.MarshalManifestJSON(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := hex.EncodeToString(e.Root)
+
+	for _, tt := range []struct {
+		path string
+		want []byte
+		etag string
+	}{
+		{"/" + name, file, `"` + root + `"`},
+		{"/" + archive.ManifestJSONName, mjson, ""},
+		{"/block/13.ssz", read((*archive.BlockReader).BlockBytes), `"` + root + `-block-13"`},
+		{"/header/13.ssz", read((*archive.BlockReader).HeaderBytes), `"` + root + `-header-13"`},
+		{"/receipts/13.ssz", read((*archive.BlockReader).ReceiptsBytes), `"` + root + `-receipts-13"`},
+	} {
+		rec := serve(s, http.MethodGet, tt.path, nil)
+		b, _ := io.ReadAll(rec.Result().Body)
+		if rec.Code != http.StatusOK || !bytes.Equal(b, tt.want) {
+			t.Errorf("GET %s = %d, %d bytes; want %d bytes", tt.path, rec.Code, len(b), len(tt.want))
+			continue
+		}
+		etag := rec.Header().Get("ETag")
+		if etag == "" || (tt.etag != "" && etag != tt.etag) {
+			t.Errorf("GET %s: ETag %s, want %s", tt.path, etag, tt.etag)
+		}
+
+		rec = serve(s, http.MethodGet, tt.path, http.Header{"Range": {"bytes=4-9"}})
+		b, _ = io.ReadAll(rec.Result().Body)
+		if rec.Code != http.StatusPartialContent || !bytes.Equal(b, tt.want[4:10]) {
+			t.Errorf("GET %s, bytes 4-9 = %d, %x; want 206, %x", tt.path, rec.Code, b, tt.want[4:10])
+		}
+		if rec = serve(s, http.MethodGet, tt.path, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+			t.Errorf("GET %s, If-None-Match its ETag = %d, want 304", tt.path, rec.Code)
+		}
+		if rec = serve(s, http.MethodGet, tt.path, http.Header{"If-None-Match": {`"other"`}}); rec.Code != http.StatusOK {
+			t.Errorf("GET %s, If-None-Match another ETag = %d, want 200", tt.path, rec.Code)
+		}
+		rec = serve(s, http.MethodHead, tt.path, nil)
+		if b, _ := io.ReadAll(rec.Result().Body); rec.Code != http.StatusOK || len(b) != 0 {
+			t.Errorf("HEAD %s = %d, %d bytes; want 200 without body", tt.path, rec.Code, len(b))
+		}
+	}
+
+	for _, path := range []string{"/unknown.ssz", "/block/20.ssz", "/block/x.ssz", "/block/12", "/other/13.ssz"} {
+		if rec := serve(s, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := serve(s, http.MethodPost, "/"+name, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /%s = %d, want 405", name, rec.Code)
+	}
+}
+
+func serve(h http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
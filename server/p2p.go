@@ -0,0 +1,478 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// The messages of the eth/66 devp2p protocol served by EthHandler follow
+// go-ethereum's eth/protocols/eth, which is not imported as it requires a
+// full node backend. See https://github.com/ethereum/devp2p/blob/master/caps/eth.md.
+
+const (
+	ethProtocolName    = "eth"
+	ethProtocolVersion = 66
+	ethProtocolLength  = 17
+	maxMessageSize     = 10 * 1024 * 1024
+	handshakeTimeout   = 5 * time.Second
+
+	// Response limits, as in go-ethereum.
+	softResponseLimit = 2 * 1024 * 1024
+	maxHeadersServe   = 1024
+	maxBodiesServe    = 1024
+	maxReceiptsServe  = 1024
+)
+
+const (
+	statusMsg                = 0x00
+	getBlockHeadersMsg       = 0x03
+	blockHeadersMsg          = 0x04
+	getBlockBodiesMsg        = 0x05
+	blockBodiesMsg           = 0x06
+	getPooledTransactionsMsg = 0x09
+	pooledTransactionsMsg    = 0x0a
+	getNodeDataMsg           = 0x0d
+	nodeDataMsg              = 0x0e
+	getReceiptsMsg           = 0x0f
+	receiptsMsg              = 0x10
+)
+
+type statusPacket struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+// hashOrNumber is a block hash or number, encoded as either.
+type hashOrNumber struct {
+	Hash   common.Hash
+	Number uint64
+}
+
+func (hn *hashOrNumber) EncodeRLP(w io.Writer) error {
+	if hn.Hash == (common.Hash{}) {
+		return rlp.Encode(w, hn.Number)
+	}
+	if hn.Number != 0 {
+		return fmt.Errorf("both origin hash (%x) and number (%d) provided", hn.Hash, hn.Number)
+	}
+	return rlp.Encode(w, hn.Hash)
+}
+
+func (hn *hashOrNumber) DecodeRLP(s *rlp.Stream) error {
+	_, size, err := s.Kind()
+	switch {
+	case err != nil:
+		return err
+	case size == 32:
+		hn.Number = 0
+		return s.Decode(&hn.Hash)
+	case size <= 8:
+		hn.Hash = common.Hash{}
+		return s.Decode(&hn.Number)
+	default:
+		return fmt.Errorf("invalid input size %d for origin", size)
+	}
+}
+
+type getBlockHeadersPacket struct {
+	Origin  hashOrNumber
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+type getBlockHeadersPacket66 struct {
+	RequestID uint64
+	Query     getBlockHeadersPacket
+}
+
+// hashesPacket66 is a request for items by hash: GetBlockBodies,
+// GetReceipts, GetNodeData or GetPooledTransactions.
+type hashesPacket66 struct {
+	RequestID uint64
+	Hashes    []common.Hash
+}
+
+// rawPacket66 is a response holding encoded items.
+type rawPacket66 struct {
+	RequestID uint64
+	Items     []rlp.RawValue
+}
+
+// enrEntry is the "eth" entry of the node record, which discovery uses to
+// find eth peers of a network.
+type enrEntry struct {
+	ForkID forkid.ID
+	Rest   []rlp.RawValue `rlp:"tail"`
+}
+
+func (enrEntry) ENRKey() string {
+	return "eth"
+}
+
+// EthHandler serves the history requests of the eth/66 devp2p protocol
+// (GetBlockHeaders, GetBlockBodies and GetReceipts) from an archive
+// directory, so that nodes can backfill pruned history from it. It announces
+// the last archived block as its head, ignores block and transaction
+// announcements, and answers state and transaction pool requests with empty
+// responses.
+type EthHandler struct {
+	files  *archiveFiles
+	ix     *archive.HashIndex
+	config *params.ChainConfig
+	status statusPacket
+	filter forkid.Filter
+	// PeerConnected and PeerDisconnected, if set, are called when a peer
+	// completes the handshake, and when it disconnects.
+	PeerConnected    func(p *p2p.Peer)
+	PeerDisconnected func(p *p2p.Peer, err error)
+}
+
+// NewEthHandler returns the handler for the archive directory dir, described
+// by manifest m and indexed by ix, of the network with the given chain
+// configuration, network id and genesis hash. The configuration is required,
+// as peers check the fork id derived from its fork blocks. A zero genesis
+// hash is taken from the archived block 0, which must otherwise match it.
+func NewEthHandler(dir string, m *spec.Manifest, ix *archive.HashIndex, config *params.ChainConfig, networkID uint64, genesis common.Hash) (*EthHandler, error) {
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("manifest has no files")
+	}
+	if config == nil {
+		return nil, fmt.Errorf("chain configuration required")
+	}
+	h := &EthHandler{files: newArchiveFiles(dir, m), ix: ix, config: config}
+	last := m.Files[len(m.Files)-1]
+	head := last.HeadBlockNumber + uint64(last.BlockCount) - 1
+	headHash, err := h.blockHash(head)
+	if err != nil {
+		return nil, err
+	}
+	if sh, err := h.files.header(0); err != nil {
+		return nil, err
+	} else if sh != nil {
+		hash, err := h.blockHash(0)
+		if err != nil {
+			return nil, err
+		}
+		if genesis != (common.Hash{}) && genesis != hash {
+			return nil, fmt.Errorf("archived block 0 has hash %x, not the genesis hash %x", hash, genesis)
+		}
+		genesis = hash
+	} else if genesis == (common.Hash{}) {
+		return nil, fmt.Errorf("genesis hash unknown: block 0 is not archived")
+	}
+	td, ok, err := ix.TotalDifficulty(head)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		td = new(big.Int)
+	}
+	h.status = statusPacket{
+		ProtocolVersion: ethProtocolVersion,
+		NetworkID:       networkID,
+		TD:              td,
+		Head:            headHash,
+		Genesis:         genesis,
+		ForkID:          forkid.NewID(config, genesis, head),
+	}
+	h.filter = forkid.NewStaticFilter(config, genesis)
+	return h, nil
+}
+
+func (h *EthHandler) blockHash(n uint64) (common.Hash, error) {
+	sh, err := h.files.header(n)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if sh == nil {
+		return common.Hash{}, fmt.Errorf("block %d is not archived", n)
+	}
+	hdr, err := sh.ToTypes()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return hdr.Hash(), nil
+}
+
+// Close closes the archive files opened to serve requests.
+func (h *EthHandler) Close() error {
+	return h.files.close()
+}
+
+// ForkID returns the fork id announced to peers, for the last archived
+// block.
+func (h *EthHandler) ForkID() forkid.ID {
+	return h.status.ForkID
+}
+
+// Protocols returns the eth protocol, to run in a p2p.Server.
+func (h *EthHandler) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:       ethProtocolName,
+		Version:    ethProtocolVersion,
+		Length:     ethProtocolLength,
+		Run:        h.run,
+		Attributes: []enr.Entry{&enrEntry{ForkID: h.status.ForkID}},
+	}}
+}
+
+func (h *EthHandler) run(peer *p2p.Peer, rw p2p.MsgReadWriter) (err error) {
+	if err := h.handshake(rw); err != nil {
+		return err
+	}
+	if h.PeerConnected != nil {
+		h.PeerConnected(peer)
+	}
+	if h.PeerDisconnected != nil {
+		defer func() { h.PeerDisconnected(peer, err) }()
+	}
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > maxMessageSize {
+			return fmt.Errorf("message too large: %d > %d", msg.Size, maxMessageSize)
+		}
+		err = h.handleMsg(rw, msg)
+		msg.Discard()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handshake exchanges status messages, and checks that the peer is on the
+// same network and chain.
+func (h *EthHandler) handshake(rw p2p.MsgReadWriter) error {
+	errc := make(chan error, 2)
+	go func() {
+		errc <- p2p.Send(rw, statusMsg, &h.status)
+	}()
+	go func() {
+		errc <- h.readStatus(rw)
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return p2p.DiscReadTimeout
+		}
+	}
+	return nil
+}
+
+func (h *EthHandler) readStatus(rw p2p.MsgReadWriter) error {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != statusMsg {
+		return fmt.Errorf("first message has code %d, expected status", msg.Code)
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("message too large: %d > %d", msg.Size, maxMessageSize)
+	}
+	var status statusPacket
+	if err := msg.Decode(&status); err != nil {
+		return fmt.Errorf("invalid status message: %s", err)
+	}
+	if status.NetworkID != h.status.NetworkID {
+		return fmt.Errorf("network id mismatch: %d (!= %d)", status.NetworkID, h.status.NetworkID)
+	}
+	if status.ProtocolVersion != h.status.ProtocolVersion {
+		return fmt.Errorf("protocol version mismatch: %d (!= %d)", status.ProtocolVersion, h.status.ProtocolVersion)
+	}
+	if status.Genesis != h.status.Genesis {
+		return fmt.Errorf("genesis mismatch: %x (!= %x)", status.Genesis, h.status.Genesis)
+	}
+	if err := h.filter(status.ForkID); err != nil {
+		return fmt.Errorf("fork id rejected: %s", err)
+	}
+	return nil
+}
+
+func (h *EthHandler) handleMsg(rw p2p.MsgReadWriter, msg p2p.Msg) error {
+	switch msg.Code {
+	case getBlockHeadersMsg:
+		var req getBlockHeadersPacket66
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("invalid GetBlockHeaders: %s", err)
+		}
+		headers, err := h.headers(&req.Query)
+		if err != nil {
+			return err
+		}
+		return p2p.Send(rw, blockHeadersMsg, &rawPacket66{req.RequestID, headers})
+	case getBlockBodiesMsg:
+		var req hashesPacket66
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("invalid GetBlockBodies: %s", err)
+		}
+		bodies, err := h.bodies(req.Hashes)
+		if err != nil {
+			return err
+		}
+		return p2p.Send(rw, blockBodiesMsg, &rawPacket66{req.RequestID, bodies})
+	case getReceiptsMsg:
+		var req hashesPacket66
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("invalid GetReceipts: %s", err)
+		}
+		receipts, err := h.receipts(req.Hashes)
+		if err != nil {
+			return err
+		}
+		return p2p.Send(rw, receiptsMsg, &rawPacket66{req.RequestID, receipts})
+	case getNodeDataMsg, getPooledTransactionsMsg:
+		// Archives hold neither state nor pending transactions.
+		var req hashesPacket66
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("invalid request: %s", err)
+		}
+		code := uint64(nodeDataMsg)
+		if msg.Code == getPooledTransactionsMsg {
+			code = pooledTransactionsMsg
+		}
+		return p2p.Send(rw, code, &rawPacket66{req.RequestID, []rlp.RawValue{}})
+	default:
+		// Announcements, and responses we never asked for.
+		return nil
+	}
+}
+
+// headers answers a GetBlockHeaders query. As archived blocks are
+// canonical, a query by hash is a query by number from the block's number.
+func (h *EthHandler) headers(q *getBlockHeadersPacket) ([]rlp.RawValue, error) {
+	headers := []rlp.RawValue{}
+	number := q.Origin.Number
+	if q.Origin.Hash != (common.Hash{}) {
+		n, ok, err := h.ix.BlockNumber(q.Origin.Hash)
+		if !ok || err != nil {
+			return headers, err
+		}
+		number = n
+	}
+	if q.Skip >= 1<<63 {
+		return headers, nil
+	}
+	step := q.Skip + 1
+	size := 0
+	for uint64(len(headers)) < q.Amount && len(headers) < maxHeadersServe && size < softResponseLimit {
+		sh, err := h.files.header(number)
+		if sh == nil || err != nil {
+			return headers, err
+		}
+		hdr, err := sh.ToTypes()
+		if err != nil {
+			return nil, err
+		}
+		b, err := rlp.EncodeToBytes(hdr)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, b)
+		size += len(b)
+		if q.Reverse {
+			if number < step {
+				break
+			}
+			number -= step
+		} else {
+			if number+step < number {
+				break
+			}
+			number += step
+		}
+	}
+	return headers, nil
+}
+
+// bodies answers a GetBlockBodies request, skipping unknown blocks.
+func (h *EthHandler) bodies(hashes []common.Hash) ([]rlp.RawValue, error) {
+	bodies := []rlp.RawValue{}
+	size := 0
+	for _, hash := range hashes {
+		if len(bodies) >= maxBodiesServe || size >= softResponseLimit {
+			break
+		}
+		sb, err := h.blockByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if sb == nil {
+			continue
+		}
+		block, _, err := sb.ToTypesWithConfig(h.config)
+		if err != nil {
+			return nil, err
+		}
+		b, err := rlp.EncodeToBytes(block.Body())
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, b)
+		size += len(b)
+	}
+	return bodies, nil
+}
+
+// receipts answers a GetReceipts request, skipping unknown blocks and
+// blocks archived without receipts.
+func (h *EthHandler) receipts(hashes []common.Hash) ([]rlp.RawValue, error) {
+	receipts := []rlp.RawValue{}
+	size := 0
+	for _, hash := range hashes {
+		if len(receipts) >= maxReceiptsServe || size >= softResponseLimit {
+			break
+		}
+		sb, err := h.blockByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if sb == nil || len(sb.Receipts) != len(sb.Transactions) {
+			continue
+		}
+		_, rs, err := sb.ToTypesWithConfig(h.config)
+		if err != nil {
+			return nil, err
+		}
+		b, err := rlp.EncodeToBytes(rs)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, b)
+		size += len(b)
+	}
+	return receipts, nil
+}
+
+func (h *EthHandler) blockByHash(hash common.Hash) (*spec.Block, error) {
+	n, ok, err := h.ix.BlockNumber(hash)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return h.files.block(n)
+}
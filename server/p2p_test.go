@@ -0,0 +1,163 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+// startP2P runs a devp2p server with the given protocols on the loopback
+// interface.
+func startP2P(t *testing.T, protocols []p2p.Protocol) *p2p.Server {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		MaxPeers:    10,
+		Name:        "test",
+		ListenAddr:  "127.0.0.1:0",
+		NoDiscovery: true,
+		Protocols:   protocols,
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+var errClientTimeout = errors.New("eth client timeout")
+
+// ethClient connects to the node with an eth/66 client, which sends status
+// and then runs session.
+func ethClient(t *testing.T, node *p2p.Server, status *statusPacket, session func(rw p2p.MsgReadWriter) error) error {
+	t.Helper()
+	errc := make(chan error, 1)
+	client := startP2P(t, []p2p.Protocol{{
+		Name:    ethProtocolName,
+		Version: ethProtocolVersion,
+		Length:  ethProtocolLength,
+		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			errc <- func() error {
+				if err := p2p.Send(rw, statusMsg, status); err != nil {
+					return err
+				}
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				var st statusPacket
+				if msg.Code != statusMsg {
+					return fmt.Errorf("first message has code %d", msg.Code)
+				}
+				if err := msg.Decode(&st); err != nil {
+					return err
+				}
+				if st.Genesis != status.Genesis || st.NetworkID != status.NetworkID {
+					return fmt.Errorf("unexpected status %+v", st)
+				}
+				return session(rw)
+			}()
+			return nil
+		},
+	}})
+	client.AddPeer(node.Self())
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(10 * time.Second):
+		return errClientTimeout
+	}
+}
+
+func TestEthHandler(t *testing.T) {
+	dir, m, ix := testArchiveDir(t, 30, 10)
+	blocks, _ := testchain.Generate(30)
+	genesis := blocks[0].Hash()
+	h, err := NewEthHandler(dir, m, ix, testchain.Config, 1337, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if want := forkid.NewID(testchain.Config, genesis, 29); h.ForkID() != want {
+		t.Errorf("fork id %v, want %v", h.ForkID(), want)
+	}
+	node := startP2P(t, h.Protocols())
+
+	status := &statusPacket{
+		ProtocolVersion: ethProtocolVersion,
+		NetworkID:       1337,
+		TD:              blocks[29].Difficulty(),
+		Head:            blocks[29].Hash(),
+		Genesis:         genesis,
+		ForkID:          forkid.NewID(testchain.Config, genesis, 29),
+	}
+	err = ethClient(t, node, status, func(rw p2p.MsgReadWriter) error {
+		for _, q := range []getBlockHeadersPacket{
+			{Origin: hashOrNumber{Number: 5}, Amount: 3, Skip: 1},
+			{Origin: hashOrNumber{Hash: blocks[12].Hash()}, Amount: 4, Reverse: true},
+		} {
+			if err := p2p.Send(rw, getBlockHeadersMsg, &getBlockHeadersPacket66{RequestID: 7, Query: q}); err != nil {
+				return err
+			}
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				return err
+			}
+			var res struct {
+				RequestID uint64
+				Headers   []*types.Header
+			}
+			if msg.Code != blockHeadersMsg {
+				return fmt.Errorf("response has code %d", msg.Code)
+			}
+			if err := msg.Decode(&res); err != nil {
+				return err
+			}
+			var want []common.Hash
+			if q.Reverse {
+				want = []common.Hash{blocks[12].Hash(), blocks[11].Hash(), blocks[10].Hash(), blocks[9].Hash()}
+			} else {
+				want = []common.Hash{blocks[5].Hash(), blocks[7].Hash(), blocks[9].Hash()}
+			}
+			if res.RequestID != 7 || len(res.Headers) != len(want) {
+				return fmt.Errorf("query %+v: response %d has %d headers, want %d", q, res.RequestID, len(res.Headers), len(want))
+			}
+			for i, hdr := range res.Headers {
+				if hdr.Hash() != want[i] {
+					return fmt.Errorf("query %+v: header %d is block %d", q, i, hdr.Number)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peers with an incompatible fork id are disconnected, possibly before
+	// they read the handler's status.
+	bad := *status
+	bad.ForkID = forkid.ID{Hash: [4]byte{1, 2, 3, 4}}
+	connected := errors.New("peer with an incompatible fork id not disconnected")
+	err = ethClient(t, node, &bad, func(rw p2p.MsgReadWriter) error {
+		if _, err := rw.ReadMsg(); err == nil {
+			return connected
+		}
+		return nil
+	})
+	if err == connected || err == errClientTimeout {
+		t.Fatal(err)
+	}
+}
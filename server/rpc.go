@@ -0,0 +1,364 @@
+// Package server serves archive directories: historical JSON-RPC methods
+// answered from archive files, and the archive files themselves over HTTP.
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/henridf/eip44s-proto/archive"
+	"github.com/henridf/eip44s-proto/spec"
+)
+
+// The JSON encoding of blocks, transactions and receipts follows geth's
+// (internal/ethapi), so that responses are interchangeable with those of a
+// geth node.
+
+// EthAPI implements the historical eth_ JSON-RPC methods over an archive
+// directory, using its hash index (see archive.HashIndex).
+type EthAPI struct {
+	ix     *archive.HashIndex
+	files  *archiveFiles
+	last   uint64
+	config *params.ChainConfig
+	sender func(number uint64, tx *types.Transaction) (common.Address, error)
+	// MaxLogs bounds the number of logs returned by eth_getLogs (0 for no
+	// limit).
+	MaxLogs int
+}
+
+// NewEthAPI returns the API for the archive directory dir, described by
+// manifest m and indexed by ix. config is the chain configuration of the
+// archived network, or nil if unknown (see archive.ChainConfig).
+func NewEthAPI(dir string, m *spec.Manifest, ix *archive.HashIndex, config *params.ChainConfig) (*EthAPI, error) {
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("manifest has no files")
+	}
+	api := &EthAPI{ix: ix, files: newArchiveFiles(dir, m), config: config, sender: archive.SenderFunc(config)}
+	last := m.Files[len(m.Files)-1]
+	api.last = last.HeadBlockNumber + uint64(last.BlockCount) - 1
+	return api, nil
+}
+
+// Close closes the archive files opened to search logs.
+func (api *EthAPI) Close() error {
+	return api.files.close()
+}
+
+// NewRPCServer returns a JSON-RPC server (an http.Handler) serving api under
+// the eth namespace.
+func NewRPCServer(api *EthAPI) (*rpc.Server, error) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", api); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// resolve returns the block number designated by n. Tags designate the last
+// archived block, except "earliest".
+func (api *EthAPI) resolve(n rpc.BlockNumber) uint64 {
+	if n == rpc.EarliestBlockNumber {
+		return 0
+	}
+	if n < 0 {
+		return api.last
+	}
+	return uint64(n)
+}
+
+// block reads and converts block number n, returning a nil block if it is
+// not archived.
+func (api *EthAPI) block(n uint64) (*types.Block, types.Receipts, error) {
+	sb, ok, err := api.ix.Block(n)
+	if !ok || err != nil {
+		return nil, nil, err
+	}
+	return sb.ToTypesWithConfig(api.config)
+}
+
+func (api *EthAPI) blockByHash(hash common.Hash) (*types.Block, types.Receipts, error) {
+	n, ok, err := api.ix.BlockNumber(hash)
+	if !ok || err != nil {
+		return nil, nil, err
+	}
+	return api.block(n)
+}
+
+// GetBlockByNumber implements eth_getBlockByNumber.
+func (api *EthAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	b, _, err := api.block(api.resolve(number))
+	if b == nil || err != nil {
+		return nil, err
+	}
+	return api.marshalBlock(b, fullTx)
+}
+
+// GetBlockByHash implements eth_getBlockByHash.
+func (api *EthAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	b, _, err := api.blockByHash(hash)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	return api.marshalBlock(b, fullTx)
+}
+
+// GetTransactionByHash implements eth_getTransactionByHash.
+func (api *EthAPI) GetTransactionByHash(ctx context.Context, hash common.Hash) (*RPCTransaction, error) {
+	n, i, ok, err := api.ix.TxLocation(hash)
+	if !ok || err != nil {
+		return nil, err
+	}
+	b, _, err := api.block(n)
+	if b == nil || err != nil || i >= len(b.Transactions()) {
+		return nil, err
+	}
+	return api.newRPCTransaction(b, i), nil
+}
+
+// GetTransactionReceipt implements eth_getTransactionReceipt.
+func (api *EthAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	n, i, ok, err := api.ix.TxLocation(hash)
+	if !ok || err != nil {
+		return nil, err
+	}
+	b, receipts, err := api.block(n)
+	if b == nil || err != nil || i >= len(receipts) {
+		return nil, err
+	}
+	return api.marshalReceipt(b, receipts[i], i), nil
+}
+
+// GetBlockReceipts implements eth_getBlockReceipts.
+func (api *EthAPI) GetBlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	var b *types.Block
+	var receipts types.Receipts
+	var err error
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		b, receipts, err = api.blockByHash(hash)
+	} else if n, ok := blockNrOrHash.Number(); ok {
+		b, receipts, err = api.block(api.resolve(n))
+	} else {
+		return nil, fmt.Errorf("invalid arguments; neither block nor hash specified")
+	}
+	if b == nil || err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, len(receipts))
+	for i, r := range receipts {
+		result[i] = api.marshalReceipt(b, r, i)
+	}
+	return result, nil
+}
+
+// GetLogs implements eth_getLogs.
+func (api *EthAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
+	f := archive.LogFilter{Addresses: crit.Addresses, Topics: crit.Topics}
+	if crit.BlockHash != nil {
+		n, ok, err := api.ix.BlockNumber(*crit.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown block")
+		}
+		f.FromBlock, f.ToBlock = n, n
+	} else {
+		f.FromBlock, f.ToBlock = api.last, api.last
+		if crit.FromBlock != nil {
+			f.FromBlock = api.resolve(*crit.FromBlock)
+		}
+		if crit.ToBlock != nil {
+			f.ToBlock = api.resolve(*crit.ToBlock)
+		}
+	}
+	logs := []*types.Log{}
+	err := api.files.filterLogs(f, func(l *archive.FilteredLog) error {
+		if api.MaxLogs > 0 && len(logs) >= api.MaxLogs {
+			return fmt.Errorf("query returned more than %d results", api.MaxLogs)
+		}
+		logs = append(logs, l.ToTypes())
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (api *EthAPI) marshalHeader(head *types.Header) map[string]interface{} {
+	result := map[string]interface{}{
+		"number":           (*hexutil.Big)(head.Number),
+		"hash":             head.Hash(),
+		"parentHash":       head.ParentHash,
+		"nonce":            head.Nonce,
+		"mixHash":          head.MixDigest,
+		"sha3Uncles":       head.UncleHash,
+		"logsBloom":        head.Bloom,
+		"stateRoot":        head.Root,
+		"miner":            head.Coinbase,
+		"difficulty":       (*hexutil.Big)(head.Difficulty),
+		"extraData":        hexutil.Bytes(head.Extra),
+		"size":             hexutil.Uint64(head.Size()),
+		"gasLimit":         hexutil.Uint64(head.GasLimit),
+		"gasUsed":          hexutil.Uint64(head.GasUsed),
+		"timestamp":        hexutil.Uint64(head.Time),
+		"transactionsRoot": head.TxHash,
+		"receiptsRoot":     head.ReceiptHash,
+	}
+	if head.BaseFee != nil {
+		result["baseFeePerGas"] = (*hexutil.Big)(head.BaseFee)
+	}
+	return result
+}
+
+func (api *EthAPI) marshalBlock(b *types.Block, fullTx bool) (map[string]interface{}, error) {
+	fields := api.marshalHeader(b.Header())
+	fields["size"] = hexutil.Uint64(b.Size())
+	txs := b.Transactions()
+	transactions := make([]interface{}, len(txs))
+	for i, tx := range txs {
+		if fullTx {
+			transactions[i] = api.newRPCTransaction(b, i)
+		} else {
+			transactions[i] = tx.Hash()
+		}
+	}
+	fields["transactions"] = transactions
+	uncles := b.Uncles()
+	uncleHashes := make([]common.Hash, len(uncles))
+	for i, uncle := range uncles {
+		uncleHashes[i] = uncle.Hash()
+	}
+	fields["uncles"] = uncleHashes
+	td, ok, err := api.ix.TotalDifficulty(b.NumberU64())
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		fields["totalDifficulty"] = (*hexutil.Big)(td)
+	}
+	return fields, nil
+}
+
+// RPCTransaction is the JSON-RPC representation of a transaction.
+type RPCTransaction struct {
+	BlockHash        *common.Hash      `json:"blockHash"`
+	BlockNumber      *hexutil.Big      `json:"blockNumber"`
+	From             common.Address    `json:"from"`
+	Gas              hexutil.Uint64    `json:"gas"`
+	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	GasFeeCap        *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	GasTipCap        *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Hash             common.Hash       `json:"hash"`
+	Input            hexutil.Bytes     `json:"input"`
+	Nonce            hexutil.Uint64    `json:"nonce"`
+	To               *common.Address   `json:"to"`
+	TransactionIndex *hexutil.Uint64   `json:"transactionIndex"`
+	Value            *hexutil.Big      `json:"value"`
+	Type             hexutil.Uint64    `json:"type"`
+	Accesses         *types.AccessList `json:"accessList,omitempty"`
+	ChainID          *hexutil.Big      `json:"chainId,omitempty"`
+	V                *hexutil.Big      `json:"v"`
+	R                *hexutil.Big      `json:"r"`
+	S                *hexutil.Big      `json:"s"`
+}
+
+// newRPCTransaction returns the i-th transaction of block b. As with geth, a
+// sender that cannot be recovered is left as the zero address.
+func (api *EthAPI) newRPCTransaction(b *types.Block, i int) *RPCTransaction {
+	tx := b.Transactions()[i]
+	from, _ := api.sender(b.NumberU64(), tx)
+	v, r, s := tx.RawSignatureValues()
+	blockHash := b.Hash()
+	index := uint64(i)
+	result := &RPCTransaction{
+		BlockHash:        &blockHash,
+		BlockNumber:      (*hexutil.Big)(b.Number()),
+		TransactionIndex: (*hexutil.Uint64)(&index),
+		Type:             hexutil.Uint64(tx.Type()),
+		From:             from,
+		Gas:              hexutil.Uint64(tx.Gas()),
+		GasPrice:         (*hexutil.Big)(tx.GasPrice()),
+		Hash:             tx.Hash(),
+		Input:            hexutil.Bytes(tx.Data()),
+		Nonce:            hexutil.Uint64(tx.Nonce()),
+		To:               tx.To(),
+		Value:            (*hexutil.Big)(tx.Value()),
+		V:                (*hexutil.Big)(v),
+		R:                (*hexutil.Big)(r),
+		S:                (*hexutil.Big)(s),
+	}
+	switch tx.Type() {
+	case types.AccessListTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+	case types.DynamicFeeTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+		result.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		result.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
+		if baseFee := b.BaseFee(); baseFee != nil {
+			// price = min(tip, gasFeeCap - baseFee) + baseFee
+			price := math.BigMin(new(big.Int).Add(tx.GasTipCap(), baseFee), tx.GasFeeCap())
+			result.GasPrice = (*hexutil.Big)(price)
+		} else {
+			result.GasPrice = (*hexutil.Big)(tx.GasFeeCap())
+		}
+	}
+	return result
+}
+
+// marshalReceipt returns the receipt of the i-th transaction of block b,
+// with the zero address as sender if it cannot be recovered.
+func (api *EthAPI) marshalReceipt(b *types.Block, receipt *types.Receipt, i int) map[string]interface{} {
+	tx := b.Transactions()[i]
+	from, _ := api.sender(b.NumberU64(), tx)
+	fields := map[string]interface{}{
+		"blockHash":         b.Hash(),
+		"blockNumber":       hexutil.Uint64(b.NumberU64()),
+		"transactionHash":   tx.Hash(),
+		"transactionIndex":  hexutil.Uint64(i),
+		"from":              from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+		"type":              hexutil.Uint(tx.Type()),
+	}
+	// The effective gas price depends on the base fee from London on. Without
+	// a chain configuration, the presence of the base fee tells.
+	london := b.BaseFee() != nil
+	if api.config != nil {
+		london = api.config.IsLondon(b.Number())
+	}
+	if !london {
+		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
+	} else {
+		gasPrice := new(big.Int).Add(b.BaseFee(), tx.EffectiveGasTipValue(b.BaseFee()))
+		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
+	}
+	if len(receipt.PostState) > 0 {
+		fields["root"] = hexutil.Bytes(receipt.PostState)
+	} else {
+		fields["status"] = hexutil.Uint(receipt.Status)
+	}
+	if receipt.Logs == nil {
+		fields["logs"] = []*types.Log{}
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+func TestGetLogs(t *testing.T) {
+	dir, m, ix := testArchiveDir(t, 40, 10)
+	api, err := NewEthAPI(dir, m, ix, testchain.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+	// Only the files holding blocks in the range are read.
+	if err := os.Remove(filepath.Join(dir, string(m.Files[0].Name))); err != nil {
+		t.Fatal(err)
+	}
+	from, to := rpc.BlockNumber(12), rpc.BlockNumber(27)
+	crit := FilterCriteria{FromBlock: &from, ToBlock: &to, Topics: [][]common.Hash{{testchain.Topic}}}
+	logs, err := api.GetLogs(context.Background(), crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Fatal("no logs")
+	}
+	for _, l := range logs {
+		if l.BlockNumber < 12 || l.BlockNumber > 27 || l.Topics[0] != testchain.Topic {
+			t.Errorf("log %+v does not match the filter", l)
+		}
+	}
+	again, err := api.GetLogs(context.Background(), crit)
+	if err != nil || len(again) != len(logs) {
+		t.Errorf("second GetLogs = %d logs, %v; want %d", len(again), err, len(logs))
+	}
+	from = 5
+	if _, err := api.GetLogs(context.Background(), crit); err == nil {
+		t.Error("GetLogs of a missing file succeeded")
+	}
+}
+
+func TestGetTransactionSender(t *testing.T) {
+	dir, m, ix := testArchiveDir(t, 10, 10)
+	blocks, _ := testchain.Generate(10)
+	tx := blocks[3].Transactions()[1]
+	api, err := NewEthAPI(dir, m, ix, testchain.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+	rtx, err := api.GetTransactionByHash(context.Background(), tx.Hash())
+	if err != nil || rtx == nil {
+		t.Fatalf("GetTransactionByHash = %v, %v", rtx, err)
+	}
+	if rtx.From != testchain.Sender {
+		t.Errorf("sender is %s, want %s", rtx.From, testchain.Sender)
+	}
+
+	// As with geth, a sender that cannot be recovered is the zero address.
+	api.sender = func(uint64, *types.Transaction) (common.Address, error) {
+		return common.Address{}, types.ErrInvalidSig
+	}
+	rtx, err = api.GetTransactionByHash(context.Background(), tx.Hash())
+	if err != nil || rtx == nil || rtx.From != (common.Address{}) {
+		t.Errorf("GetTransactionByHash without sender = %+v, %v; want the zero sender", rtx, err)
+	}
+	r, err := api.GetTransactionReceipt(context.Background(), tx.Hash())
+	if err != nil || r == nil || r["from"] != (common.Address{}) {
+		t.Errorf("GetTransactionReceipt without sender = %v, %v; want the zero sender", r, err)
+	}
+}
+
+// TestGolden compares responses to those of geth v1.10.18 (internal/ethapi)
+// for the same chain, recorded in testdata. geth does not implement
+// eth_getBlockReceipts: its recorded results are lists of the
+// eth_getTransactionReceipt results of each block.
+func TestGolden(t *testing.T) {
+	dir, m, ix := testArchiveDir(t, 6, 4)
+	api, err := NewEthAPI(dir, m, ix, testchain.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+	srv, err := NewRPCServer(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(srv)
+	defer client.Close()
+	for _, method := range []string{"eth_getBlockByNumber", "eth_getTransactionByHash", "eth_getTransactionReceipt", "eth_getBlockReceipts"} {
+		b, err := os.ReadFile(filepath.Join("testdata", method+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calls []struct {
+			Params []json.RawMessage `json:"params"`
+			Result json.RawMessage   `json:"result"`
+		}
+		if err := json.Unmarshal(b, &calls); err != nil {
+			t.Fatalf("%s: %s", method, err)
+		}
+		for _, c := range calls {
+			args := make([]interface{}, len(c.Params))
+			for i, p := range c.Params {
+				args[i] = p
+			}
+			var res json.RawMessage
+			if err := client.Call(&res, method, args...); err != nil {
+				t.Errorf("%s%s: %s", method, c.Params, err)
+				continue
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(res, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(c.Result, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s%s = %s, want %s", method, c.Params, res, c.Result)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package spec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	ssz "github.com/ferranbt/fastssz"
+)
+
+// HashTreeRootParallel computes the same root as HashTreeRoot, but hashes
+// the block subtrees on multiple goroutines before merkleizing the block
+// list.
+func (a *ArchiveBody) HashTreeRootParallel(workers int) ([32]byte, error) {
+	roots := make([][32]byte, len(a.Blocks))
+	err := forEachBlock(len(a.Blocks), workers, func(i int) (err error) {
+		roots[i], err = a.Blocks[i].HashTreeRoot()
+		return err
+	})
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return blockListRoot(roots)
+}
+
+// HashTreeRootCached computes the same root as HashTreeRoot, reusing the
+// block roots in cache for blocks whose ssz encoding has not changed, so that
+// only new or changed blocks are hashed. Blocks are identified by the sha256
+// digest of their encoding. It returns the root along with an updated cache
+// for the current blocks. A nil cache is treated as empty.
+func (a *ArchiveBody) HashTreeRootCached(workers int, cache *BlockRootCache) ([32]byte, *BlockRootCache, error) {
+	if cache == nil {
+		cache = &BlockRootCache{}
+	}
+	if len(cache.Digests) != len(cache.Roots) {
+		return [32]byte{}, nil, fmt.Errorf("invalid block root cache: %d digests, %d roots", len(cache.Digests), len(cache.Roots))
+	}
+	n := len(a.Blocks)
+	updated := &BlockRootCache{
+		Digests: make([][]byte, n),
+		Roots:   make([][]byte, n),
+	}
+	roots := make([][32]byte, n)
+	err := forEachBlock(n, workers, func(i int) error {
+		b, err := a.Blocks[i].MarshalSSZ()
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(b)
+		updated.Digests[i] = digest[:]
+		if i < len(cache.Digests) && bytes.Equal(cache.Digests[i], digest[:]) {
+			copy(roots[i][:], cache.Roots[i])
+		} else if roots[i], err = a.Blocks[i].HashTreeRoot(); err != nil {
+			return err
+		}
+		updated.Roots[i] = append([]byte(nil), roots[i][:]...)
+		return nil
+	})
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+	root, err := blockListRoot(roots)
+	return root, updated, err
+}
+
+// ArchiveBodyRoot returns the hash_tree_root of an archive body whose blocks
+// have the given roots.
+func ArchiveBodyRoot(blockRoots [][32]byte) ([32]byte, error) {
+	return blockListRoot(blockRoots)
+}
+
+// blockListRoot merkleizes a list of block roots the way
+// ArchiveBody.HashTreeRootWith does.
+func blockListRoot(roots [][32]byte) ([32]byte, error) {
+	num := uint64(len(roots))
+	if num > MaxBlocks {
+		return [32]byte{}, ssz.ErrIncorrectListSize
+	}
+	hh := ssz.NewHasher()
+	indx := hh.Index()
+	subIndx := hh.Index()
+	for i := range roots {
+		hh.Append(roots[i][:])
+	}
+	hh.MerkleizeWithMixin(subIndx, num, MaxBlocks)
+	hh.Merkleize(indx)
+	return hh.HashRoot()
+}
+
+// forEachBlock calls fn for each block index in [0, n) on up to workers
+// goroutines, and returns the first error.
+func forEachBlock(n, workers int, fn func(i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	var once sync.Once
+	var ferr error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				if err := fn(i); err != nil {
+					once.Do(func() { ferr = err })
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	return ferr
+}
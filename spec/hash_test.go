@@ -0,0 +1,108 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+func testArchive(t *testing.T, n int) *ArchiveBody {
+	t.Helper()
+	blocks, receipts := testchain.Generate(n)
+	arc := &ArchiveBody{}
+	for i, b := range blocks {
+		sb, err := NewBlock(b, receipts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		arc.Blocks = append(arc.Blocks, sb)
+	}
+	return arc
+}
+
+func TestHashTreeRootParallelAndCached(t *testing.T) {
+	arc := testArchive(t, 300)
+	want, err := arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 3, 16} {
+		root, err := arc.HashTreeRootParallel(workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != want {
+			t.Fatalf("HashTreeRootParallel(%d) = %x, want %x", workers, root, want)
+		}
+	}
+
+	root, cache, err := arc.HashTreeRootCached(4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Fatalf("HashTreeRootCached without cache = %x, want %x", root, want)
+	}
+	root, cache, err = arc.HashTreeRootCached(4, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Fatalf("HashTreeRootCached with cache = %x, want %x", root, want)
+	}
+
+	// Change a block, and append blocks: the cached roots of the other
+	// blocks are reused.
+	arc.Blocks[10].Header.Timestamp++
+	arc.Blocks = append(arc.Blocks, testArchive(t, 310).Blocks[300:]...)
+	want, err = arc.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, updated, err := arc.HashTreeRootCached(4, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Fatalf("HashTreeRootCached with stale cache = %x, want %x", root, want)
+	}
+	if len(updated.Roots) != len(arc.Blocks) {
+		t.Fatalf("updated cache has %d roots, want %d", len(updated.Roots), len(arc.Blocks))
+	}
+
+	// Blocks whose body or receipts changed, under the same header, are
+	// rehashed.
+	for _, change := range []struct {
+		name string
+		edit func(b *Block)
+	}{
+		{"receipt", func(b *Block) { b.Receipts[0].CumulativeGasUsed++ }},
+		{"log", func(b *Block) { b.Receipts[1].Logs[0].Data = append(b.Receipts[1].Logs[0].Data, 1) }},
+		{"transaction", func(b *Block) { b.Transactions[0] = append([]byte{}, b.Transactions[0]...); b.Transactions[0][5] ^= 1 }},
+		{"uncle", func(b *Block) { b.Uncles[0].GasUsed++ }},
+	} {
+		cache := updated
+		old := want
+		b := arc.Blocks[15]
+		if len(b.Transactions) < 2 || len(b.Uncles) == 0 {
+			t.Fatalf("block 15 has %d transactions and %d uncles", len(b.Transactions), len(b.Uncles))
+		}
+		change.edit(b)
+		if want, err = arc.HashTreeRoot(); err != nil {
+			t.Fatal(err)
+		}
+		if want == old {
+			t.Fatalf("%s change does not change the root", change.name)
+		}
+		if root, updated, err = arc.HashTreeRootCached(4, cache); err != nil {
+			t.Fatal(err)
+		}
+		if root != want {
+			t.Errorf("HashTreeRootCached after a %s change = %x, want %x", change.name, root, want)
+		}
+	}
+
+	if _, _, err := arc.HashTreeRootCached(4, &BlockRootCache{Digests: make([][]byte, 1)}); err == nil {
+		t.Fatal("expected error for inconsistent cache")
+	}
+}
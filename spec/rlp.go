@@ -16,6 +16,8 @@ type extblock struct {
 	Uncles []*types.Header
 }
 
+// fillHdr converts a header whose field lengths have been checked (see
+// Header.ToTypes).
 func fillHdr(eh *Header) *types.Header {
 	hdr := types.Header{
 		ParentHash:  *(*[32]byte)(eh.ParentHash),
@@ -71,8 +73,10 @@ func (r *Receipt) EncodeRLP(w io.Writer) error {
 }
 
 func blockEncodeRLP(e *Block, w io.Writer, receipts bool) error {
-
-	hdr := fillHdr(e.Header)
+	hdr, err := e.Header.ToTypes()
+	if err != nil {
+		return err
+	}
 	var txs = make([]*types.Transaction, len(e.Transactions))
 	for i, encTx := range e.Transactions {
 		var tx types.Transaction
@@ -83,11 +87,14 @@ func blockEncodeRLP(e *Block, w io.Writer, receipts bool) error {
 	}
 	var uncles []*types.Header
 	for i := 0; i < len(e.Uncles); i++ {
-		uncles = append(uncles, fillHdr(e.Uncles[i]))
-
+		uncle, err := e.Uncles[i].ToTypes()
+		if err != nil {
+			return err
+		}
+		uncles = append(uncles, uncle)
 	}
 
-	err := rlp.Encode(w, extblock{
+	err = rlp.Encode(w, extblock{
 		Header: hdr,
 		Txs:    txs,
 		Uncles: uncles,
@@ -150,25 +157,7 @@ func blockDecodeRLP(e *Block, s *rlp.Stream, withreceipts bool) error {
 		return err
 	}
 	for i := 0; i < len(receipts); i++ {
-		p := &Receipt{}
-		if len(receipts[i].PostState) > 0 {
-			p.PostState = receipts[i].PostState
-		} else {
-			p.Status = receipts[i].Status
-		}
-		p.CumulativeGasUsed = receipts[i].CumulativeGasUsed
-		for _, rlplog := range receipts[i].Logs {
-			log := &Log{Address: rlplog.Address[:], Data: rlplog.Data}
-			for j := 0; j < len(rlplog.Topics); j++ {
-				topic := rlplog.Topics[j]
-				// xxx ugly conversion from []common.Hash to [][]byte...
-				// maybe just common.Hash directly? (here and elsewhere)
-				log.Topics = append(log.Topics, []byte(topic[:]))
-			}
-			p.Logs = append(p.Logs, log)
-		}
-		e.Receipts = append(e.Receipts, p)
+		e.Receipts = append(e.Receipts, NewReceipt((*types.Receipt)(receipts[i])))
 	}
-
 	return nil
 }
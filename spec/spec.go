@@ -8,9 +8,12 @@ import (
 
 // go run sszgen/*.go --path ../../work/eip4444/
 
+// MaxBlocks and MaxFiles are the ssz-max limits of the archive block list
+// and of the manifest file list.
 const (
 	Version   = 0
 	MaxBlocks = 1000000
+	MaxFiles  = 1000000
 )
 
 type ArchiveHeader struct {
@@ -22,6 +25,31 @@ type ArchiveBody struct {
 	Blocks []*Block `ssz-max:"1000000"`
 }
 
+// Manifest describes a set of archive files, such as the sequence of files
+// written when splitting a conversion by target size.
+type Manifest struct {
+	Version uint64
+	Files   []*ManifestEntry `ssz-max:"1000000"`
+}
+
+type ManifestEntry struct {
+	Name            []byte `ssz-max:"256"`
+	HeadBlockNumber uint64
+	BlockCount      uint32
+	Root            []byte `ssz-size:"32"`
+	Size            uint64
+	Sha256          []byte `ssz-size:"32"`
+}
+
+// BlockRootCache holds the hash_tree_root of each block of an archive,
+// along with the sha256 digest of the block's ssz encoding, so that the root
+// of a modified or extended archive can be recomputed without rehashing
+// unchanged blocks.
+type BlockRootCache struct {
+	Digests [][]byte `ssz-max:"1000000" ssz-size:"?,32"`
+	Roots   [][]byte `ssz-max:"1000000" ssz-size:"?,32"`
+}
+
 type Block struct {
 	Header       *Header    `ssz-max:"604"`
 	Transactions [][]byte   `ssz-max:"1048576,1073741824" ssz-size:"?,?"`
@@ -62,6 +90,7 @@ type Log struct {
 	Data    []byte   `ssz-max:"4194304"`           // 4194452
 }
 
+// Deprecated: use NewBlock.
 func FromBlock() *Block {
 	return &Block{}
 }
@@ -99,7 +128,12 @@ func FromHeader(h *types.Header) (*Header, error) {
 	return sh, nil
 }
 
+// Deprecated: use NewBlock.
 func FillBlock(sb *Block, b types.Block) error {
+	return fillBlock(sb, &b)
+}
+
+func fillBlock(sb *Block, b *types.Block) error {
 	eh, err := FromHeader(b.Header())
 	if err != nil {
 		return err
@@ -125,25 +159,9 @@ func FillBlock(sb *Block, b types.Block) error {
 	return nil
 }
 
+// Deprecated: use NewBlock.
 func FillReceipts(sb *Block, receipts []*types.Receipt) {
 	for i := 0; i < len(receipts); i++ {
-		p := &Receipt{}
-		if len(receipts[i].PostState) > 0 {
-			p.PostState = receipts[i].PostState
-		} else {
-			p.Status = receipts[i].Status
-		}
-		p.CumulativeGasUsed = receipts[i].CumulativeGasUsed
-		for _, rlplog := range receipts[i].Logs {
-			log := &Log{Address: rlplog.Address[:], Data: rlplog.Data}
-			for j := 0; j < len(rlplog.Topics); j++ {
-				topic := rlplog.Topics[j]
-				// xxx ugly conversion from []common.Hash to [][]byte...
-				// maybe just common.Hash directly? (here and elsewhere)
-				log.Topics = append(log.Topics, []byte(topic[:]))
-			}
-			p.Logs = append(p.Logs, log)
-		}
-		sb.Receipts = append(sb.Receipts, p)
+		sb.Receipts = append(sb.Receipts, NewReceipt(receipts[i]))
 	}
 }
@@ -1,5 +1,5 @@
 // Code generated by fastssz. DO NOT EDIT.
-// Hash: 102b687a840f702c0ccd938f04c34a98b1967b4f7a7cedee9a01a3288e89d6f3
+// Hash: 40d1f02daaebb94c1f1e114dd6c06abec904853a12c1107fdc4d610d26acb6dc
 // Version: 0.1.2
 package spec
 
@@ -210,6 +210,482 @@ func (a *ArchiveBody) GetTree() (*ssz.Node, error) {
 	return ssz.ProofTree(a)
 }
 
+// MarshalSSZ ssz marshals the Manifest object
+func (m *Manifest) MarshalSSZ() ([]byte, error) {
+	return ssz.MarshalSSZ(m)
+}
+
+// MarshalSSZTo ssz marshals the Manifest object to a target array
+func (m *Manifest) MarshalSSZTo(buf []byte) (dst []byte, err error) {
+	dst = buf
+	offset := int(12)
+
+	// Field (0) 'Version'
+	dst = ssz.MarshalUint64(dst, m.Version)
+
+	// Offset (1) 'Files'
+	dst = ssz.WriteOffset(dst, offset)
+	for ii := 0; ii < len(m.Files); ii++ {
+		offset += 4
+		offset += m.Files[ii].SizeSSZ()
+	}
+
+	// Field (1) 'Files'
+	if size := len(m.Files); size > 1000000 {
+		err = ssz.ErrListTooBigFn("Manifest.Files", size, 1000000)
+		return
+	}
+	{
+		offset = 4 * len(m.Files)
+		for ii := 0; ii < len(m.Files); ii++ {
+			dst = ssz.WriteOffset(dst, offset)
+			offset += m.Files[ii].SizeSSZ()
+		}
+	}
+	for ii := 0; ii < len(m.Files); ii++ {
+		if dst, err = m.Files[ii].MarshalSSZTo(dst); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// UnmarshalSSZ ssz unmarshals the Manifest object
+func (m *Manifest) UnmarshalSSZ(buf []byte) error {
+	var err error
+	size := uint64(len(buf))
+	if size < 12 {
+		return ssz.ErrSize
+	}
+
+	tail := buf
+	var o1 uint64
+
+	// Field (0) 'Version'
+	m.Version = ssz.UnmarshallUint64(buf[0:8])
+
+	// Offset (1) 'Files'
+	if o1 = ssz.ReadOffset(buf[8:12]); o1 > size {
+		return ssz.ErrOffset
+	}
+
+	if o1 < 12 {
+		return ssz.ErrInvalidVariableOffset
+	}
+
+	// Field (1) 'Files'
+	{
+		buf = tail[o1:]
+		num, err := ssz.DecodeDynamicLength(buf, 1000000)
+		if err != nil {
+			return err
+		}
+		m.Files = make([]*ManifestEntry, num)
+		err = ssz.UnmarshalDynamic(buf, num, func(indx int, buf []byte) (err error) {
+			if m.Files[indx] == nil {
+				m.Files[indx] = new(ManifestEntry)
+			}
+			if err = m.Files[indx].UnmarshalSSZ(buf); err != nil {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// SizeSSZ returns the ssz encoded size in bytes for the Manifest object
+func (m *Manifest) SizeSSZ() (size int) {
+	size = 12
+
+	// Field (1) 'Files'
+	for ii := 0; ii < len(m.Files); ii++ {
+		size += 4
+		size += m.Files[ii].SizeSSZ()
+	}
+
+	return
+}
+
+// HashTreeRoot ssz hashes the Manifest object
+func (m *Manifest) HashTreeRoot() ([32]byte, error) {
+	return ssz.HashWithDefaultHasher(m)
+}
+
+// HashTreeRootWith ssz hashes the Manifest object with a hasher
+func (m *Manifest) HashTreeRootWith(hh ssz.HashWalker) (err error) {
+	indx := hh.Index()
+
+	// Field (0) 'Version'
+	hh.PutUint64(m.Version)
+
+	// Field (1) 'Files'
+	{
+		subIndx := hh.Index()
+		num := uint64(len(m.Files))
+		if num > 1000000 {
+			err = ssz.ErrIncorrectListSize
+			return
+		}
+		for _, elem := range m.Files {
+			if err = elem.HashTreeRootWith(hh); err != nil {
+				return
+			}
+		}
+		hh.MerkleizeWithMixin(subIndx, num, 1000000)
+	}
+
+	hh.Merkleize(indx)
+	return
+}
+
+// GetTree ssz hashes the Manifest object
+func (m *Manifest) GetTree() (*ssz.Node, error) {
+	return ssz.ProofTree(m)
+}
+
+// MarshalSSZ ssz marshals the ManifestEntry object
+func (m *ManifestEntry) MarshalSSZ() ([]byte, error) {
+	return ssz.MarshalSSZ(m)
+}
+
+// MarshalSSZTo ssz marshals the ManifestEntry object to a target array
+func (m *ManifestEntry) MarshalSSZTo(buf []byte) (dst []byte, err error) {
+	dst = buf
+	offset := int(88)
+
+	// Offset (0) 'Name'
+	dst = ssz.WriteOffset(dst, offset)
+	offset += len(m.Name)
+
+	// Field (1) 'HeadBlockNumber'
+	dst = ssz.MarshalUint64(dst, m.HeadBlockNumber)
+
+	// Field (2) 'BlockCount'
+	dst = ssz.MarshalUint32(dst, m.BlockCount)
+
+	// Field (3) 'Root'
+	if size := len(m.Root); size != 32 {
+		err = ssz.ErrBytesLengthFn("ManifestEntry.Root", size, 32)
+		return
+	}
+	dst = append(dst, m.Root...)
+
+	// Field (4) 'Size'
+	dst = ssz.MarshalUint64(dst, m.Size)
+
+	// Field (5) 'Sha256'
+	if size := len(m.Sha256); size != 32 {
+		err = ssz.ErrBytesLengthFn("ManifestEntry.Sha256", size, 32)
+		return
+	}
+	dst = append(dst, m.Sha256...)
+
+	// Field (0) 'Name'
+	if size := len(m.Name); size > 256 {
+		err = ssz.ErrBytesLengthFn("ManifestEntry.Name", size, 256)
+		return
+	}
+	dst = append(dst, m.Name...)
+
+	return
+}
+
+// UnmarshalSSZ ssz unmarshals the ManifestEntry object
+func (m *ManifestEntry) UnmarshalSSZ(buf []byte) error {
+	var err error
+	size := uint64(len(buf))
+	if size < 88 {
+		return ssz.ErrSize
+	}
+
+	tail := buf
+	var o0 uint64
+
+	// Offset (0) 'Name'
+	if o0 = ssz.ReadOffset(buf[0:4]); o0 > size {
+		return ssz.ErrOffset
+	}
+
+	if o0 < 88 {
+		return ssz.ErrInvalidVariableOffset
+	}
+
+	// Field (1) 'HeadBlockNumber'
+	m.HeadBlockNumber = ssz.UnmarshallUint64(buf[4:12])
+
+	// Field (2) 'BlockCount'
+	m.BlockCount = ssz.UnmarshallUint32(buf[12:16])
+
+	// Field (3) 'Root'
+	if cap(m.Root) == 0 {
+		m.Root = make([]byte, 0, len(buf[16:48]))
+	}
+	m.Root = append(m.Root, buf[16:48]...)
+
+	// Field (4) 'Size'
+	m.Size = ssz.UnmarshallUint64(buf[48:56])
+
+	// Field (5) 'Sha256'
+	if cap(m.Sha256) == 0 {
+		m.Sha256 = make([]byte, 0, len(buf[56:88]))
+	}
+	m.Sha256 = append(m.Sha256, buf[56:88]...)
+
+	// Field (0) 'Name'
+	{
+		buf = tail[o0:]
+		if len(buf) > 256 {
+			return ssz.ErrBytesLength
+		}
+		if cap(m.Name) == 0 {
+			m.Name = make([]byte, 0, len(buf))
+		}
+		m.Name = append(m.Name, buf...)
+	}
+	return err
+}
+
+// SizeSSZ returns the ssz encoded size in bytes for the ManifestEntry object
+func (m *ManifestEntry) SizeSSZ() (size int) {
+	size = 88
+
+	// Field (0) 'Name'
+	size += len(m.Name)
+
+	return
+}
+
+// HashTreeRoot ssz hashes the ManifestEntry object
+func (m *ManifestEntry) HashTreeRoot() ([32]byte, error) {
+	return ssz.HashWithDefaultHasher(m)
+}
+
+// HashTreeRootWith ssz hashes the ManifestEntry object with a hasher
+func (m *ManifestEntry) HashTreeRootWith(hh ssz.HashWalker) (err error) {
+	indx := hh.Index()
+
+	// Field (0) 'Name'
+	{
+		elemIndx := hh.Index()
+		byteLen := uint64(len(m.Name))
+		if byteLen > 256 {
+			err = ssz.ErrIncorrectListSize
+			return
+		}
+		hh.PutBytes(m.Name)
+		hh.MerkleizeWithMixin(elemIndx, byteLen, (256+31)/32)
+	}
+
+	// Field (1) 'HeadBlockNumber'
+	hh.PutUint64(m.HeadBlockNumber)
+
+	// Field (2) 'BlockCount'
+	hh.PutUint32(m.BlockCount)
+
+	// Field (3) 'Root'
+	if size := len(m.Root); size != 32 {
+		err = ssz.ErrBytesLengthFn("ManifestEntry.Root", size, 32)
+		return
+	}
+	hh.PutBytes(m.Root)
+
+	// Field (4) 'Size'
+	hh.PutUint64(m.Size)
+
+	// Field (5) 'Sha256'
+	if size := len(m.Sha256); size != 32 {
+		err = ssz.ErrBytesLengthFn("ManifestEntry.Sha256", size, 32)
+		return
+	}
+	hh.PutBytes(m.Sha256)
+
+	hh.Merkleize(indx)
+	return
+}
+
+// GetTree ssz hashes the ManifestEntry object
+func (m *ManifestEntry) GetTree() (*ssz.Node, error) {
+	return ssz.ProofTree(m)
+}
+
+// MarshalSSZ ssz marshals the BlockRootCache object
+func (b *BlockRootCache) MarshalSSZ() ([]byte, error) {
+	return ssz.MarshalSSZ(b)
+}
+
+// MarshalSSZTo ssz marshals the BlockRootCache object to a target array
+func (b *BlockRootCache) MarshalSSZTo(buf []byte) (dst []byte, err error) {
+	dst = buf
+	offset := int(8)
+
+	// Offset (0) 'Digests'
+	dst = ssz.WriteOffset(dst, offset)
+	offset += len(b.Digests) * 32
+
+	// Offset (1) 'Roots'
+	dst = ssz.WriteOffset(dst, offset)
+	offset += len(b.Roots) * 32
+
+	// Field (0) 'Digests'
+	if size := len(b.Digests); size > 1000000 {
+		err = ssz.ErrListTooBigFn("BlockRootCache.Digests", size, 1000000)
+		return
+	}
+	for ii := 0; ii < len(b.Digests); ii++ {
+		if size := len(b.Digests[ii]); size != 32 {
+			err = ssz.ErrBytesLengthFn("BlockRootCache.Digests[ii]", size, 32)
+			return
+		}
+		dst = append(dst, b.Digests[ii]...)
+	}
+
+	// Field (1) 'Roots'
+	if size := len(b.Roots); size > 1000000 {
+		err = ssz.ErrListTooBigFn("BlockRootCache.Roots", size, 1000000)
+		return
+	}
+	for ii := 0; ii < len(b.Roots); ii++ {
+		if size := len(b.Roots[ii]); size != 32 {
+			err = ssz.ErrBytesLengthFn("BlockRootCache.Roots[ii]", size, 32)
+			return
+		}
+		dst = append(dst, b.Roots[ii]...)
+	}
+
+	return
+}
+
+// UnmarshalSSZ ssz unmarshals the BlockRootCache object
+func (b *BlockRootCache) UnmarshalSSZ(buf []byte) error {
+	var err error
+	size := uint64(len(buf))
+	if size < 8 {
+		return ssz.ErrSize
+	}
+
+	tail := buf
+	var o0, o1 uint64
+
+	// Offset (0) 'Digests'
+	if o0 = ssz.ReadOffset(buf[0:4]); o0 > size {
+		return ssz.ErrOffset
+	}
+
+	if o0 < 8 {
+		return ssz.ErrInvalidVariableOffset
+	}
+
+	// Offset (1) 'Roots'
+	if o1 = ssz.ReadOffset(buf[4:8]); o1 > size || o0 > o1 {
+		return ssz.ErrOffset
+	}
+
+	// Field (0) 'Digests'
+	{
+		buf = tail[o0:o1]
+		num, err := ssz.DivideInt2(len(buf), 32, 1000000)
+		if err != nil {
+			return err
+		}
+		b.Digests = make([][]byte, num)
+		for ii := 0; ii < num; ii++ {
+			if cap(b.Digests[ii]) == 0 {
+				b.Digests[ii] = make([]byte, 0, len(buf[ii*32:(ii+1)*32]))
+			}
+			b.Digests[ii] = append(b.Digests[ii], buf[ii*32:(ii+1)*32]...)
+		}
+	}
+
+	// Field (1) 'Roots'
+	{
+		buf = tail[o1:]
+		num, err := ssz.DivideInt2(len(buf), 32, 1000000)
+		if err != nil {
+			return err
+		}
+		b.Roots = make([][]byte, num)
+		for ii := 0; ii < num; ii++ {
+			if cap(b.Roots[ii]) == 0 {
+				b.Roots[ii] = make([]byte, 0, len(buf[ii*32:(ii+1)*32]))
+			}
+			b.Roots[ii] = append(b.Roots[ii], buf[ii*32:(ii+1)*32]...)
+		}
+	}
+	return err
+}
+
+// SizeSSZ returns the ssz encoded size in bytes for the BlockRootCache object
+func (b *BlockRootCache) SizeSSZ() (size int) {
+	size = 8
+
+	// Field (0) 'Digests'
+	size += len(b.Digests) * 32
+
+	// Field (1) 'Roots'
+	size += len(b.Roots) * 32
+
+	return
+}
+
+// HashTreeRoot ssz hashes the BlockRootCache object
+func (b *BlockRootCache) HashTreeRoot() ([32]byte, error) {
+	return ssz.HashWithDefaultHasher(b)
+}
+
+// HashTreeRootWith ssz hashes the BlockRootCache object with a hasher
+func (b *BlockRootCache) HashTreeRootWith(hh ssz.HashWalker) (err error) {
+	indx := hh.Index()
+
+	// Field (0) 'Digests'
+	{
+		if size := len(b.Digests); size > 1000000 {
+			err = ssz.ErrListTooBigFn("BlockRootCache.Digests", size, 1000000)
+			return
+		}
+		subIndx := hh.Index()
+		for _, i := range b.Digests {
+			if len(i) != 32 {
+				err = ssz.ErrBytesLength
+				return
+			}
+			hh.Append(i)
+		}
+		numItems := uint64(len(b.Digests))
+		hh.MerkleizeWithMixin(subIndx, numItems, ssz.CalculateLimit(1000000, numItems, 32))
+	}
+
+	// Field (1) 'Roots'
+	{
+		if size := len(b.Roots); size > 1000000 {
+			err = ssz.ErrListTooBigFn("BlockRootCache.Roots", size, 1000000)
+			return
+		}
+		subIndx := hh.Index()
+		for _, i := range b.Roots {
+			if len(i) != 32 {
+				err = ssz.ErrBytesLength
+				return
+			}
+			hh.Append(i)
+		}
+		numItems := uint64(len(b.Roots))
+		hh.MerkleizeWithMixin(subIndx, numItems, ssz.CalculateLimit(1000000, numItems, 32))
+	}
+
+	hh.Merkleize(indx)
+	return
+}
+
+// GetTree ssz hashes the BlockRootCache object
+func (b *BlockRootCache) GetTree() (*ssz.Node, error) {
+	return ssz.ProofTree(b)
+}
+
 // MarshalSSZ ssz marshals the Block object
 func (b *Block) MarshalSSZ() ([]byte, error) {
 	return ssz.MarshalSSZ(b)
@@ -0,0 +1,215 @@
+package spec
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Conversions between archive types and go-ethereum types.
+
+// NewBlock converts a go-ethereum block and its receipts. Receipts may be nil
+// for a block without receipts.
+func NewBlock(b *types.Block, receipts types.Receipts) (*Block, error) {
+	sb := &Block{}
+	if err := fillBlock(sb, b); err != nil {
+		return nil, err
+	}
+	for _, r := range receipts {
+		sb.Receipts = append(sb.Receipts, NewReceipt(r))
+	}
+	return sb, nil
+}
+
+// NewReceipt converts the consensus fields of a go-ethereum receipt.
+func NewReceipt(r *types.Receipt) *Receipt {
+	p := &Receipt{}
+	if len(r.PostState) > 0 {
+		p.PostState = r.PostState
+	} else {
+		p.Status = r.Status
+	}
+	p.CumulativeGasUsed = r.CumulativeGasUsed
+	for _, l := range r.Logs {
+		p.Logs = append(p.Logs, NewLog(l))
+	}
+	return p
+}
+
+// NewLog converts the consensus fields of a go-ethereum log.
+func NewLog(l *types.Log) *Log {
+	log := &Log{Address: l.Address[:], Data: l.Data}
+	for j := 0; j < len(l.Topics); j++ {
+		topic := l.Topics[j]
+		// xxx ugly conversion from []common.Hash to [][]byte...
+		// maybe just common.Hash directly? (here and elsewhere)
+		log.Topics = append(log.Topics, []byte(topic[:]))
+	}
+	return log
+}
+
+func checkLen(field string, b []byte, n int) error {
+	if len(b) != n {
+		return fmt.Errorf("invalid %s length %d", field, len(b))
+	}
+	return nil
+}
+
+// ToTypes converts the header to a go-ethereum header.
+func (h *Header) ToTypes() (*types.Header, error) {
+	for _, f := range []struct {
+		name string
+		b    []byte
+		n    int
+	}{
+		{"ParentHash", h.ParentHash, 32},
+		{"UncleHash", h.UncleHash, 32},
+		{"FeeRecipient", h.FeeRecipient, 20},
+		{"StateRoot", h.StateRoot, 32},
+		{"TxHash", h.TxHash, 32},
+		{"ReceiptsRoot", h.ReceiptsRoot, 32},
+		{"LogsBloom", h.LogsBloom, 256},
+		{"Difficulty", h.Difficulty, 32},
+		{"BaseFeePerGas", h.BaseFeePerGas, 32},
+		{"MixDigest", h.MixDigest, 32},
+		{"Nonce", h.Nonce, 8},
+	} {
+		if err := checkLen(f.name, f.b, f.n); err != nil {
+			return nil, fmt.Errorf("header %d: %s", h.BlockNumber, err)
+		}
+	}
+	return fillHdr(h), nil
+}
+
+// ToTypes converts the block to a go-ethereum block and receipts. Receipts
+// have their derived fields (transaction hash and type, block location, gas
+// used, contract address and log positions) filled in. The returned receipts
+// are nil if the block has none, as in archives converted from rlp exports
+// without receipts. The senders of contract creations are recovered without a
+// chain configuration (see Sender).
+func (b *Block) ToTypes() (*types.Block, types.Receipts, error) {
+	return b.ToTypesWithConfig(nil)
+}
+
+// ToTypesWithConfig is like ToTypes, but recovers the senders of contract
+// creations with the fork rules of the chain configuration cfg.
+func (b *Block) ToTypesWithConfig(cfg *params.ChainConfig) (*types.Block, types.Receipts, error) {
+	hdr, err := b.Header.ToTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	txs := make([]*types.Transaction, len(b.Transactions))
+	for i, encTx := range b.Transactions {
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(encTx); err != nil {
+			return nil, nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs[i] = &tx
+	}
+	var uncles []*types.Header
+	for i := 0; i < len(b.Uncles); i++ {
+		uncle, err := b.Uncles[i].ToTypes()
+		if err != nil {
+			return nil, nil, err
+		}
+		uncles = append(uncles, uncle)
+	}
+	block := types.NewBlockWithHeader(hdr).WithBody(txs, uncles)
+	if len(b.Receipts) == 0 {
+		return block, nil, nil
+	}
+	if len(b.Receipts) != len(txs) {
+		return nil, nil, fmt.Errorf("block %d has %d transactions but %d receipts", b.Header.BlockNumber, len(txs), len(b.Receipts))
+	}
+	receipts := make(types.Receipts, len(b.Receipts))
+	for i, r := range b.Receipts {
+		receipts[i] = r.ToTypes()
+	}
+	deriveReceiptFields(receipts, block, cfg)
+	return block, receipts, nil
+}
+
+// ToTypes converts the consensus fields of the receipt to a go-ethereum
+// receipt, including its logs bloom.
+func (r *Receipt) ToTypes() *types.Receipt {
+	tr := &types.Receipt{
+		PostState:         r.PostState,
+		Status:            r.Status,
+		CumulativeGasUsed: r.CumulativeGasUsed,
+		Logs:              []*types.Log{},
+	}
+	if len(r.PostState) > 0 {
+		// Pre-byzantium receipts carry a state root instead of a status.
+		tr.Status = types.ReceiptStatusSuccessful
+	}
+	for _, l := range r.Logs {
+		tr.Logs = append(tr.Logs, l.ToTypes())
+	}
+	tr.Bloom = types.CreateBloom(types.Receipts{tr})
+	return tr
+}
+
+// ToTypes converts the log to a go-ethereum log, without derived fields.
+func (l *Log) ToTypes() *types.Log {
+	tl := &types.Log{
+		Address: common.BytesToAddress(l.Address),
+		Data:    l.Data,
+		Topics:  []common.Hash{},
+	}
+	for _, t := range l.Topics {
+		tl.Topics = append(tl.Topics, common.BytesToHash(t))
+	}
+	return tl
+}
+
+// Sender recovers the sender of a transaction of block number, with the
+// signer of the block's fork in the chain configuration cfg. Without a chain
+// configuration (cfg nil), typed and EIP-155 transactions are checked with
+// the chain id they carry, and other transactions with the frontier rules.
+func Sender(cfg *params.ChainConfig, number uint64, tx *types.Transaction) (common.Address, error) {
+	if cfg != nil {
+		return types.Sender(types.MakeSigner(cfg, new(big.Int).SetUint64(number)), tx)
+	}
+	if tx.Protected() {
+		return types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	}
+	return types.Sender(types.FrontierSigner{}, tx)
+}
+
+// deriveReceiptFields is like types.Receipts.DeriveFields, but recovers
+// senders (for contract addresses) with Sender. The contract address of a
+// contract creation whose sender cannot be recovered is left empty.
+func deriveReceiptFields(rs types.Receipts, block *types.Block, cfg *params.ChainConfig) {
+	txs := block.Transactions()
+	hash, number := block.Hash(), block.NumberU64()
+	logIndex := uint(0)
+	for i := 0; i < len(rs); i++ {
+		rs[i].Type = txs[i].Type()
+		rs[i].TxHash = txs[i].Hash()
+		rs[i].BlockHash = hash
+		rs[i].BlockNumber = new(big.Int).SetUint64(number)
+		rs[i].TransactionIndex = uint(i)
+		if txs[i].To() == nil {
+			if from, err := Sender(cfg, number, txs[i]); err == nil {
+				rs[i].ContractAddress = crypto.CreateAddress(from, txs[i].Nonce())
+			}
+		}
+		if i == 0 {
+			rs[i].GasUsed = rs[i].CumulativeGasUsed
+		} else {
+			rs[i].GasUsed = rs[i].CumulativeGasUsed - rs[i-1].CumulativeGasUsed
+		}
+		for j := 0; j < len(rs[i].Logs); j++ {
+			rs[i].Logs[j].BlockNumber = number
+			rs[i].Logs[j].BlockHash = hash
+			rs[i].Logs[j].TxHash = rs[i].TxHash
+			rs[i].Logs[j].TxIndex = uint(i)
+			rs[i].Logs[j].Index = logIndex
+			logIndex++
+		}
+	}
+}
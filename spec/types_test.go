@@ -0,0 +1,131 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/henridf/eip44s-proto/internal/testchain"
+)
+
+func TestSenderForkRules(t *testing.T) {
+	tx, err := types.SignTx(types.NewTransaction(0, testchain.LogAddress, big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewEIP155Signer(params.MainnetChainConfig.ChainID), testchain.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := params.MainnetChainConfig
+	for _, c := range []struct {
+		cfg    *params.ChainConfig
+		number uint64
+		ok     bool
+	}{
+		{nil, 0, true},
+		{cfg, cfg.EIP155Block.Uint64(), true},
+		// EIP-155 transactions are invalid before the fork.
+		{cfg, cfg.EIP155Block.Uint64() - 1, false},
+	} {
+		from, err := Sender(c.cfg, c.number, tx)
+		if c.ok && (err != nil || from != testchain.Sender) {
+			t.Errorf("block %d: Sender = %s, %v; want %s", c.number, from.Hex(), err, testchain.Sender.Hex())
+		}
+		if !c.ok && err == nil {
+			t.Errorf("block %d: Sender succeeded, want error", c.number)
+		}
+	}
+}
+
+func TestBlockToTypesContractAddress(t *testing.T) {
+	signer := types.LatestSignerForChainID(testchain.Config.ChainID)
+	tx, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{ChainID: testchain.Config.ChainID, Nonce: 5, Gas: 100000,
+		GasFeeCap: big.NewInt(2e9), GasTipCap: big.NewInt(1e9), Data: []byte{0}}), signer, testchain.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), BaseFee: big.NewInt(1e9)}
+	receipts := types.Receipts{{Type: tx.Type(), Status: 1, CumulativeGasUsed: 60000}}
+	b := types.NewBlock(header, types.Transactions{tx}, nil, receipts, new(testchain.Hasher))
+	sb, err := NewBlock(b, receipts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := crypto.CreateAddress(testchain.Sender, 5)
+	for _, cfg := range []*params.ChainConfig{nil, testchain.Config} {
+		_, rs, err := sb.ToTypesWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rs[0].ContractAddress != want {
+			t.Fatalf("contract address %s, want %s", rs[0].ContractAddress.Hex(), want.Hex())
+		}
+	}
+	// Typed transactions are invalid before Berlin: the block converts, but
+	// without a contract address.
+	_, rs, err := sb.ToTypesWithConfig(params.MainnetChainConfig)
+	if err != nil {
+		t.Fatalf("converting a block 1 typed contract creation with mainnet rules: %s", err)
+	}
+	if rs[0].ContractAddress != (common.Address{}) {
+		t.Fatalf("contract address %s of a transaction without sender", rs[0].ContractAddress.Hex())
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	blocks, receipts := testchain.Generate(30)
+	for i, b := range blocks {
+		sb, err := NewBlock(b, receipts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, rs, err := sb.ToTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash() != b.Hash() {
+			t.Fatalf("block %d: hash %s, want %s", i, got.Hash().Hex(), b.Hash().Hex())
+		}
+		// types.NewBlock sets the roots of empty lists without hashing them.
+		if h := types.DeriveSha(got.Transactions(), new(testchain.Hasher)); len(got.Transactions()) > 0 && h != b.TxHash() {
+			t.Errorf("block %d: transactions root %s, want %s", i, h.Hex(), b.TxHash().Hex())
+		}
+		if h := types.CalcUncleHash(got.Uncles()); h != b.UncleHash() {
+			t.Errorf("block %d: uncles hash %s, want %s", i, h.Hex(), b.UncleHash().Hex())
+		}
+		if len(receipts[i]) == 0 {
+			if rs != nil {
+				t.Errorf("block %d: %d receipts, want none", i, len(rs))
+			}
+			continue
+		}
+		if h := types.DeriveSha(rs, new(testchain.Hasher)); h != b.ReceiptHash() {
+			t.Errorf("block %d: receipts root %s, want %s", i, h.Hex(), b.ReceiptHash().Hex())
+		}
+		// The derived fields match those derived by go-ethereum.
+		want := make(types.Receipts, len(receipts[i]))
+		for j, r := range receipts[i] {
+			want[j] = &types.Receipt{Status: r.Status, CumulativeGasUsed: r.CumulativeGasUsed, Bloom: r.Bloom, Logs: []*types.Log{}}
+			for _, l := range r.Logs {
+				want[j].Logs = append(want[j].Logs, &types.Log{Address: l.Address, Topics: l.Topics, Data: l.Data})
+			}
+		}
+		if err := want.DeriveFields(testchain.Config, b.Hash(), b.NumberU64(), b.Transactions()); err != nil {
+			t.Fatal(err)
+		}
+		gj, err := json.Marshal(rs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wj, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gj, wj) {
+			t.Errorf("block %d: receipts\n%s\nwant\n%s", i, gj, wj)
+		}
+	}
+}